@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/haierspi/pt-gateway/gateway"
+	"github.com/haierspi/pt-gateway/utils/config"
+)
+
+// checkSettings 校验网关、MQ、[server]和[tls]的配置
+func checkSettings(c *config.Checker) error {
+	c.String("mq", "url")
+	gateway.CheckSettings(c)
+	ss := loadServerSettings(c)
+	checkTLS(c, ss.HTTP2)
+	return c.Err()
+}
+
+// checkConfig check-config命令，用于CI，有问题时退出码为1
+func checkConfig() {
+	if err := checkSettings(config.NewChecker(configFile)); err != nil {
+		fmt.Fprintln(os.Stderr, configFile+":")
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println(configFile, "ok")
+}
+
+// encryptValue 实现encrypt-value命令，value为空时读标准输入
+func encryptValue(value string) {
+	if keyFile == "" {
+		fmt.Fprintln(os.Stderr, "encrypt-value: -key-file or PT_CONFIG_KEY_FILE required")
+		os.Exit(1)
+	}
+	if value == "" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		value = strings.TrimRight(string(data), "\r\n")
+	}
+	encrypted, err := config.Encrypt(keyFile, value)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println(encrypted)
+}
@@ -0,0 +1,205 @@
+// ptctl 直接调用后端方法、生成签名的网关地址和回放[record]记录的请求，用于调试
+//
+//	ptctl call examples 1.0 Examples.Echo '{"Body":"hi"}'
+//	echo '{"Body":"hi"}' | ptctl call examples 1.0 Examples.Echo -
+//	ptctl sign examples 1.0 Examples.Echo '{"Body":"hi"}'
+//	ptctl replay -url http://127.0.0.1:9000 record.jsonl
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/haierspi/pt-gateway/utils/config"
+	"github.com/haierspi/pt-gateway/utils/ptjson"
+	"github.com/haierspi/pt-gateway/utils/rpc"
+	"github.com/haierspi/pt-gateway/utils/sign"
+)
+
+var (
+	configFile = "./config.cfg"
+	envPrefix  string
+	profile    string
+	keyFile    string
+)
+
+func init() {
+	flag.StringVar(&configFile, "config", configFile, "网关配置文件，用于读取[mq] url和[gateway] signKey")
+	flag.StringVar(&envPrefix, "env-prefix", "", "环境变量前缀，与网关相同，如PT时[mq] url对应PT_MQ_URL")
+	flag.StringVar(&profile, "profile", os.Getenv("PT_PROFILE"), "配置profile，默认取环境变量PT_PROFILE")
+	flag.StringVar(&keyFile, "key-file", os.Getenv("PT_CONFIG_KEY_FILE"), "解密enc:配置值的密钥文件，默认取环境变量PT_CONFIG_KEY_FILE")
+	flag.Var(config.Overrides{}, "set", "覆盖配置，与网关相同，格式section.option=value，可以多次使用")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), `Usage: %s [flags] <command> [command flags] <module> <version> <method> [json|-]
+
+  call  通过MQ直接调用后端方法，json省略时为{}，-为读标准输入
+  sign  生成带timestamp和sign的网关地址
+
+Usage: %s [flags] replay [command flags] <record.jsonl|->
+
+  replay  回放[record]记录的请求，比较响应，有不同时退出码为1
+
+`, os.Args[0], os.Args[0])
+		flag.PrintDefaults()
+	}
+}
+
+func main() {
+	flag.Parse()
+	config.SetEnvPrefix(envPrefix)
+	config.SetProfile(profile)
+	config.SetKeyFile(keyFile)
+	var err error
+	switch flag.Arg(0) {
+	case "call":
+		err = call(flag.Args()[1:])
+	case "sign":
+		err = signURL(flag.Args()[1:])
+	case "replay":
+		err = replay(flag.Args()[1:])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// call ptctl call [-timeout 20] [-raw] [-file args.json] [-mq url] module version method [json|-]
+func call(args []string) error {
+	fs := flag.NewFlagSet("call", flag.ExitOnError)
+	timeout := fs.Int64("timeout", 20, "超时秒数")
+	raw := fs.Bool("raw", false, "原样输出回复，不格式化")
+	file := fs.String("file", "", "从文件读取参数json")
+	mqURL := fs.String("mq", "", "MQ地址，默认为配置文件的[mq] url")
+	fs.Parse(args)
+	if fs.NArg() < 3 || fs.NArg() > 4 {
+		return fmt.Errorf("usage: ptctl call [flags] <module> <version> <method> [json|-]")
+	}
+	params, err := readParams(fs.Arg(3), *file)
+	if err != nil {
+		return err
+	}
+
+	if *mqURL == "" {
+		if *mqURL, err = config.GetString(configFile, "mq", "url"); err != nil {
+			return err
+		}
+	}
+	client, err := rpc.Dial(*mqURL)
+	if err != nil {
+		return fmt.Errorf("rpc Dial %s: %w", config.MaskURL(*mqURL), err)
+	}
+	client.SetTimeout(*timeout)
+
+	var reply []byte
+	start := time.Now()
+	if err = client.JSONCall(fs.Arg(0)+"_"+fs.Arg(1), fs.Arg(2), &params, &reply); err != nil {
+		return err
+	}
+	if !*raw {
+		var pretty bytes.Buffer
+		if json.Indent(&pretty, reply, "", "  ") == nil {
+			reply = pretty.Bytes()
+		}
+	}
+	os.Stdout.Write(reply)
+	fmt.Println()
+	if !*raw {
+		fmt.Fprintln(os.Stderr, time.Since(start))
+	}
+	return nil
+}
+
+// signURL ptctl sign [-key signKey] [-url http://127.0.0.1:9000/gateway/] [-callback cb] module version method [json|-]
+func signURL(args []string) error {
+	fs := flag.NewFlagSet("sign", flag.ExitOnError)
+	key := fs.String("key", "", "签名key，默认为配置文件的[gateway] signKey")
+	gatewayURL := fs.String("url", "", "网关地址，默认按配置文件的[gateway] listen生成")
+	callback := fs.String("callback", "", "JSONP回调")
+	file := fs.String("file", "", "从文件读取bizContent json")
+	fs.Parse(args)
+	if fs.NArg() < 3 || fs.NArg() > 4 {
+		return fmt.Errorf("usage: ptctl sign [flags] <module> <version> <method> [json|-]")
+	}
+	bizContent, err := readParams(fs.Arg(3), *file)
+	if err != nil {
+		return err
+	}
+	if *key == "" {
+		if *key, err = config.GetString(configFile, "gateway", "signKey"); err != nil {
+			return err
+		}
+	}
+	if *gatewayURL == "" {
+		if *gatewayURL, err = defaultGatewayURL(); err != nil {
+			return err
+		}
+	}
+
+	values := url.Values{}
+	values.Set("module", fs.Arg(0))
+	values.Set("version", fs.Arg(1))
+	values.Set("method", fs.Arg(2))
+	values.Set("bizContent", string(bizContent))
+	values.Set("timestamp", sign.Timestamp(time.Now()))
+	if *callback != "" {
+		values.Set("callback", *callback)
+	}
+	values.Set("sign", sign.Sign(values, *key))
+	fmt.Println(*gatewayURL + "?" + values.Encode())
+	return nil
+}
+
+// readParams 参数json：-file指定的文件，-为标准输入，省略时为{}
+func readParams(arg, file string) ([]byte, error) {
+	var data []byte
+	var err error
+	switch {
+	case file != "":
+		data, err = os.ReadFile(file)
+	case arg == "-":
+		data, err = io.ReadAll(os.Stdin)
+	case arg == "":
+		data = []byte("{}")
+	default:
+		data = []byte(arg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimSpace(data)
+	if !ptjson.IsValidJSON(data) {
+		return nil, fmt.Errorf("expect a json object, got %s", data)
+	}
+	return data, nil
+}
+
+// defaultGatewayURL 按[gateway] listen生成本机地址，如0.0.0.0:9000为http://127.0.0.1:9000/gateway/
+func defaultGatewayURL() (string, error) {
+	listen, err := config.GetString(configFile, "gateway", "listen")
+	if err != nil {
+		return "", err
+	}
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return "", fmt.Errorf("[gateway] listen: %w", err)
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	scheme := "http"
+	if cert, _ := config.GetString(configFile, "tls", "cert"); cert != "" {
+		scheme = "https"
+	}
+	return scheme + "://" + net.JoinHostPort(host, port) + "/gateway/", nil
+}
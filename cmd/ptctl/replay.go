@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/haierspi/pt-gateway/gateway"
+	"github.com/haierspi/pt-gateway/utils/config"
+	"github.com/haierspi/pt-gateway/utils/jsondiff"
+	"github.com/haierspi/pt-gateway/utils/rpc"
+	"github.com/haierspi/pt-gateway/utils/sign"
+)
+
+// maxRecordLine 记录文件一行的最大长度
+const maxRecordLine = 16 << 20
+
+// replayer 回放记录，gateway模式重新发送HTTP请求，rpc模式直接调用后端方法
+type replayer struct {
+	baseURL string // gateway模式的网关地址，如http://127.0.0.1:9000
+	client  *rpc.Client
+	http    *http.Client
+	key     string
+	ignore  map[string]bool
+}
+
+// replay ptctl replay [-url http://127.0.0.1:9000 | -rpc [-mq url]] [-key signKey] [-ignore a,b.c] [-timeout 20] record.jsonl
+func replay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	gatewayURL := fs.String("url", "", "回放到网关，如http://127.0.0.1:9000，默认按配置文件的[gateway] listen生成")
+	direct := fs.Bool("rpc", false, "通过MQ直接调用后端方法，比较后端回复")
+	mqURL := fs.String("mq", "", "MQ地址，默认为配置文件的[mq] url")
+	key := fs.String("key", "", "重新签名的key，默认为配置文件的[gateway] signKey")
+	ignore := fs.String("ignore", "", "比较时忽略的json字段，逗号分隔，如Data.UpdatedAt，数组下标省略")
+	timeout := fs.Int64("timeout", 20, "超时秒数")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: ptctl replay [flags] <record.jsonl|->")
+	}
+
+	rp := &replayer{ignore: map[string]bool{}}
+	for _, name := range strings.Split(*ignore, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			rp.ignore[name] = true
+		}
+	}
+	var err error
+	if *direct {
+		if *mqURL == "" {
+			if *mqURL, err = config.GetString(configFile, "mq", "url"); err != nil {
+				return err
+			}
+		}
+		if rp.client, err = rpc.Dial(*mqURL); err != nil {
+			return fmt.Errorf("rpc Dial %s: %w", config.MaskURL(*mqURL), err)
+		}
+		rp.client.SetTimeout(*timeout)
+	} else {
+		if *gatewayURL == "" {
+			if *gatewayURL, err = defaultGatewayURL(); err != nil {
+				return err
+			}
+		}
+		u, err := url.Parse(*gatewayURL)
+		if err != nil {
+			return err
+		}
+		rp.baseURL = u.Scheme + "://" + u.Host
+		rp.http = &http.Client{Timeout: time.Duration(*timeout) * time.Second}
+		rp.key = *key
+	}
+
+	in := os.Stdin
+	if fs.Arg(0) != "-" {
+		if in, err = os.Open(fs.Arg(0)); err != nil {
+			return err
+		}
+		defer in.Close()
+	}
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), maxRecordLine)
+	var total, ok, diff, skipped, failed int
+	for n := 1; scanner.Scan(); n++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		total++
+		var record gateway.Record
+		if err := json.Unmarshal(line, &record); err != nil {
+			failed++
+			fmt.Printf("ERROR #%d: %v\n", n, err)
+			continue
+		}
+		name := fmt.Sprintf("#%d %s %s %s", n, record.Module, record.Version, record.ServiceMethod)
+		var diffs []string
+		var reason string
+		start := time.Now()
+		if rp.client != nil {
+			diffs, reason, err = rp.replayRPC(&record)
+		} else {
+			diffs, reason, err = rp.replayGateway(&record)
+		}
+		elapsed := time.Since(start).Round(time.Millisecond)
+		switch {
+		case err != nil:
+			failed++
+			fmt.Printf("ERROR %s: %v\n", name, err)
+		case reason != "":
+			skipped++
+			fmt.Printf("SKIP  %s: %s\n", name, reason)
+		case len(diffs) > 0:
+			diff++
+			fmt.Printf("DIFF  %s %v (recorded %v)\n", name, elapsed, record.Duration.Round(time.Millisecond))
+			for _, d := range diffs {
+				fmt.Println("      " + d)
+			}
+		default:
+			ok++
+			fmt.Printf("OK    %s %v (recorded %v)\n", name, elapsed, record.Duration.Round(time.Millisecond))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	fmt.Printf("total %d, ok %d, diff %d, skipped %d, error %d\n", total, ok, diff, skipped, failed)
+	if diff > 0 || failed > 0 {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// replayRPC 用记录的BizContent调用后端，与记录的Reply比较
+func (rp *replayer) replayRPC(record *gateway.Record) (diffs []string, reason string, err error) {
+	if len(record.BizContent) == 0 {
+		return nil, "not sent to backend", nil
+	}
+	args := []byte(record.BizContent)
+	var reply []byte
+	callErr := rp.client.JSONCall(record.Module+"_"+record.Version, record.ServiceMethod, &args, &reply)
+	switch {
+	case callErr != nil && record.ErrorCode == 5003 && len(record.Reply) == 0:
+		// 记录时也是后端错误
+		return nil, "", nil
+	case callErr != nil:
+		return []string{"error: " + callErr.Error()}, "", nil
+	case len(record.Reply) == 0:
+		return []string{fmt.Sprintf("errorCode: %d -> reply %s", record.ErrorCode, truncate(string(reply)))}, "", nil
+	}
+	return rp.diffJSON(record.Reply, reply), "", nil
+}
+
+// replayGateway 重新发送HTTP请求，与记录的状态码和响应比较
+func (rp *replayer) replayGateway(record *gateway.Record) (diffs []string, reason string, err error) {
+	if record.Truncated {
+		return nil, "body truncated", nil
+	}
+	path, body := record.Path, record.Body
+	if record.Mode == "default" {
+		if path, body, err = rp.resign(path, body, record.Header["Content-Type"]); err != nil {
+			return nil, "", err
+		}
+	}
+	req, err := http.NewRequest(record.HTTPMethod, rp.baseURL+path, strings.NewReader(body))
+	if err != nil {
+		return nil, "", err
+	}
+	for name, val := range record.Header {
+		req.Header.Set(name, val)
+	}
+	req.Header.Set(gateway.ReplayHeader, "1")
+	resp, err := rp.http.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode != record.StatusCode {
+		diffs = append(diffs, fmt.Sprintf("status: %d -> %d", record.StatusCode, resp.StatusCode))
+	}
+	if record.Response == "" {
+		// BodyRef等未记录响应
+		return diffs, "", nil
+	}
+	if json.Valid([]byte(record.Response)) && json.Valid(data) {
+		return append(diffs, rp.diffJSON([]byte(record.Response), data)...), "", nil
+	}
+	if record.Response != string(data) {
+		diffs = append(diffs, fmt.Sprintf("body: %s -> %s", truncate(record.Response), truncate(string(data))))
+	}
+	return diffs, "", nil
+}
+
+// resign 带sign的请求用新的timestamp重新签名，签名范围与gateway.VerifySign相同
+func (rp *replayer) resign(path, body, contentType string) (string, string, error) {
+	u, err := url.Parse(path)
+	if err != nil {
+		return "", "", err
+	}
+	query := u.Query()
+	var form url.Values
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		if form, err = url.ParseQuery(body); err != nil {
+			return "", "", err
+		}
+	}
+	signed := url.Values{}
+	for _, values := range []url.Values{form, query} {
+		for k, v := range values {
+			signed[k] = append(signed[k], v...)
+		}
+	}
+	if signed.Get("sign") == "" {
+		return path, body, nil
+	}
+	if rp.key == "" {
+		if rp.key, err = config.GetString(configFile, "gateway", "signKey"); err != nil {
+			return "", "", err
+		}
+	}
+
+	timestamp := sign.Timestamp(time.Now())
+	signed.Set("timestamp", timestamp)
+	target := query
+	if form.Get("timestamp") != "" {
+		target = form
+	}
+	target.Set("timestamp", timestamp)
+	value := sign.Sign(signed, rp.key)
+	target = query
+	if form.Get("sign") != "" {
+		target = form
+	}
+	target.Set("sign", value)
+	u.RawQuery = query.Encode()
+	if form != nil {
+		body = form.Encode()
+	}
+	return u.RequestURI(), body, nil
+}
+
+// diffJSON 比较两个json，返回不同的字段，忽略-ignore中的字段
+func (rp *replayer) diffJSON(recorded, replayed []byte) []string {
+	diffs, err := jsondiff.Diff(recorded, replayed, rp.ignore)
+	if err != nil {
+		return []string{"json: " + err.Error()}
+	}
+	return diffs
+}
+
+func truncate(s string) string {
+	if len(s) > 200 {
+		return s[:200] + "..."
+	}
+	return s
+}
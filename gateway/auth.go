@@ -0,0 +1,167 @@
+package gateway
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/haierspi/pt-gateway/utils/config"
+	"github.com/haierspi/pt-gateway/utils/jwt"
+)
+
+// authKey bizContent中的保留字段，只能由网关写入
+const authKey = "Auth"
+
+// authInfo 认证信息，注入bizContent的Auth字段，后端服务可以直接信任
+type authInfo struct {
+	UserID string
+	Roles  []string
+	Scopes []string
+	Claims jwt.Claims
+}
+
+// authProvider 认证插件，路由的authProvider选择使用哪个
+type authProvider interface {
+	authenticate(g *Gateway, token string) (*authInfo, error)
+}
+
+var authProviders = map[string]authProvider{
+	"jwt":           jwtProvider{},
+	"introspection": introspectionProvider{},
+}
+
+// jwtProvider 本地验证JWT
+type jwtProvider struct{}
+
+func (jwtProvider) authenticate(g *Gateway, token string) (*authInfo, error) {
+	return g.verifyJWT(token)
+}
+
+// getKeySet 按[jwt] jwks配置的文件或地址缓存KeySet
+func (g *Gateway) getKeySet(source string) *jwt.KeySet {
+	g.keySetsMutex.Lock()
+	defer g.keySetsMutex.Unlock()
+	keySet, ok := g.keySets[source]
+	if !ok {
+		ttl := config.StringDefault(g.configFile, "jwt", "jwksTTL", "300s")
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			d = 300 * time.Second
+		}
+		keySet = jwt.NewKeySet(source, d)
+		g.keySets[source] = keySet
+	}
+	return keySet
+}
+
+// jwtKey HS256使用[jwt] secret，RS256、ES256使用[jwt] jwks
+func (g *Gateway) jwtKey(header *jwt.Header) (interface{}, error) {
+	if header.Alg == "HS256" {
+		secret := config.StringDefault(g.configFile, "jwt", "secret", "")
+		if secret == "" {
+			return nil, jwt.ErrAlgorithm
+		}
+		return []byte(secret), nil
+	}
+	source := config.StringDefault(g.configFile, "jwt", "jwks", "")
+	if source == "" {
+		return nil, jwt.ErrAlgorithm
+	}
+	return g.getKeySet(source).KeyFunc(header)
+}
+
+// verifyJWT 验证token，返回用户和角色
+func (g *Gateway) verifyJWT(token string) (*authInfo, error) {
+	claims, err := jwt.Verify(token, g.jwtKey)
+	if err != nil {
+		return nil, err
+	}
+	leeway, err := time.ParseDuration(config.StringDefault(g.configFile, "jwt", "leeway", "30s"))
+	if err != nil {
+		leeway = 30 * time.Second
+	}
+	issuer := config.StringDefault(g.configFile, "jwt", "issuer", "")
+	audience := config.StringDefault(g.configFile, "jwt", "audience", "")
+	if err = claims.Validate(time.Now(), leeway, issuer, audience); err != nil {
+		return nil, err
+	}
+	info := &authInfo{
+		UserID: claims.String(config.StringDefault(g.configFile, "jwt", "userClaim", "sub")),
+		Roles:  claims.Strings(config.StringDefault(g.configFile, "jwt", "rolesClaim", "roles")),
+		Scopes: claims.Strings("scope"),
+		Claims: claims,
+	}
+	if info.UserID == "" {
+		return nil, errors.New("jwt: missing user claim")
+	}
+	return info, nil
+}
+
+func bearerToken(r *http.Request) string {
+	authorization := r.Header.Get("Authorization")
+	if len(authorization) > 7 && strings.EqualFold(authorization[:7], "Bearer ") {
+		return strings.TrimSpace(authorization[7:])
+	}
+	return ""
+}
+
+// authenticate 按路由的auth配置验证Authorization: Bearer，通过后写入bizContent的Auth字段
+//
+//	auth=none|optional|required     none不验证，optional有token时验证，required必须有token，不区分大小写，其他值按required处理
+//	authProvider=jwt|introspection  默认jwt
+//	authRoles=admin,ops             需要其中一个角色
+//	authScopes=orders.read          需要全部scope
+func (g *Gateway) authenticate(r *http.Request, module, version, method string, bizContent map[string]interface{}) (code int64, message string) {
+	// 客户端不能自己传Auth
+	delete(bizContent, authKey)
+
+	policy := strings.ToLower(g.routeString(module, version, method, "auth", "none"))
+	switch policy {
+	case "none":
+		return 0, ""
+	case "optional", "required":
+	default:
+		// 配置写错时不能放行
+		g.logger.Println("unknown auth:", policy, ", treated as required")
+		policy = "required"
+	}
+	token := bearerToken(r)
+	if token == "" {
+		if policy == "required" {
+			return 5006, "缺少Authorization"
+		}
+		return 0, ""
+	}
+	providerName := g.routeString(module, version, method, "authProvider", "jwt")
+	provider, ok := authProviders[providerName]
+	if !ok {
+		g.logger.Println("unknown authProvider:", providerName)
+		return 5006, "认证失败"
+	}
+	info, err := provider.authenticate(g, token)
+	if err != nil {
+		return 5006, "认证失败:" + err.Error()
+	}
+	if roles := g.routeStringSlice(module, version, method, "authRoles"); len(roles) > 0 && !containsAny(info.Roles, roles) {
+		return 5007, "权限不足"
+	}
+	for _, scope := range g.routeStringSlice(module, version, method, "authScopes") {
+		if !containsAny(info.Scopes, []string{scope}) {
+			return 5007, "缺少scope:" + scope
+		}
+	}
+	bizContent[authKey] = info
+	return 0, ""
+}
+
+func containsAny(have, want []string) bool {
+	for _, w := range want {
+		for _, h := range have {
+			if h == w {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,309 @@
+package gateway
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/haierspi/pt-gateway/utils/config"
+)
+
+// backendSettings HTTP后端，按[backend:module_version]、[backend:module]的顺序查找，都没有时使用MQ队列module_version
+//
+//	[backend:orders]
+//	type=http
+//	urls=http://10.0.0.1:8080,http://10.0.0.2:8080
+//	path=/rpc/{method}          {module}、{version}、{method}替换为请求的方法
+//	timeout=5s                  默认[gateway] timeout
+//	balance=roundRobin          roundRobin或random
+//	healthPath=/healthz         配置后每healthInterval检查一次，只转发到健康的地址
+//	healthInterval=10s
+//
+// bizContent作为json body POST到后端，2xx的body与MQ回复相同，其他状态码作为错误
+type backendSettings struct {
+	Type           string        `config:"type" default:"amqp"`
+	URLs           []string      `config:"urls"`
+	Path           string        `config:"path" default:"/{method}"`
+	Timeout        time.Duration `config:"timeout"`
+	Balance        string        `config:"balance" default:"roundRobin"`
+	HealthPath     string        `config:"healthPath"`
+	HealthInterval time.Duration `config:"healthInterval" default:"10s"`
+}
+
+// maxBackendErrorLen 日志中后端错误body的最大长度
+const maxBackendErrorLen = 512
+
+// reloadBackends 由Reload调用，按[backend:…]配置创建HTTP后端，停止已删除或修改的后端的健康检查
+func (g *Gateway) reloadBackends(timeout time.Duration) error {
+	type resolved struct {
+		settings backendSettings
+		urls     []*url.URL
+	}
+	sections := map[string]*resolved{}
+	for _, section := range config.Sections(g.configFile) {
+		if !strings.HasPrefix(section, "backend:") {
+			continue
+		}
+		var bs backendSettings
+		if err := config.Unmarshal(g.configFile, section, &bs); err != nil {
+			return err
+		}
+		if bs.Type != "http" {
+			sections[section] = nil
+			continue
+		}
+		if len(bs.URLs) == 0 {
+			return &config.OptionError{Section: section, Option: "urls", Message: "required when type is http"}
+		}
+		urls, err := parseBackendURLs(bs.URLs)
+		if err != nil {
+			return &config.OptionError{Section: section, Option: "urls", Message: err.Error()}
+		}
+		if bs.Timeout <= 0 {
+			bs.Timeout = timeout
+		}
+		sections[section] = &resolved{bs, urls}
+	}
+
+	backends := make(map[string]*backendPool, len(sections))
+	g.backendsMutex.Lock()
+	defer g.backendsMutex.Unlock()
+	for section, r := range sections {
+		if r == nil {
+			backends[section] = nil
+			continue
+		}
+		key := fmt.Sprintf("%+v", r.settings)
+		if pool := g.backends[section]; pool != nil && pool.key == key {
+			backends[section] = pool
+			continue
+		}
+		backends[section] = newBackendPool(key, r.settings, r.urls, g.logger)
+	}
+	for section, pool := range g.backends {
+		if pool != nil && backends[section] != pool {
+			pool.stop()
+		}
+	}
+	g.backends = backends
+	return nil
+}
+
+// backendCaller type=http时返回HTTP后端，否则为Options.Caller
+func (g *Gateway) backendCaller(module, version string) Caller {
+	g.backendsMutex.RLock()
+	defer g.backendsMutex.RUnlock()
+	for _, section := range []string{"backend:" + module + "_" + version, "backend:" + module} {
+		if pool, ok := g.backends[section]; ok {
+			if pool == nil {
+				return g.caller
+			}
+			return pool
+		}
+	}
+	return g.caller
+}
+
+// checkBackend 校验[backend:…]配置，用于check-config
+func checkBackend(c *config.Checker, section string) {
+	var bs backendSettings
+	c.Unmarshal(section, &bs)
+	c.Optional(section, "type", oneOf("amqp", "http"))
+	c.Optional(section, "balance", oneOf("roundRobin", "random"))
+	if bs.Type != "http" {
+		return
+	}
+	if len(bs.URLs) == 0 {
+		c.Add(&config.OptionError{Section: section, Option: "urls", Message: "required when type is http"})
+	}
+	if _, err := parseBackendURLs(bs.URLs); err != nil {
+		c.Add(&config.OptionError{Section: section, Option: "urls", Message: err.Error()})
+	}
+}
+
+func parseBackendURLs(urls []string) ([]*url.URL, error) {
+	var parsed []*url.URL
+	for _, raw := range urls {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, errors.New("expect http(s)://host[:port], got " + raw)
+		}
+		parsed = append(parsed, u)
+	}
+	return parsed, nil
+}
+
+// backendEndpoint 后端的一个地址
+type backendEndpoint struct {
+	url       *url.URL
+	unhealthy int32 // 健康检查失败或者连接失败时为1，下次健康检查成功后恢复
+}
+
+// backendPool HTTP后端，实现Caller
+type backendPool struct {
+	key       string
+	settings  backendSettings
+	endpoints []*backendEndpoint
+	client    *http.Client
+	logger    Logger
+	next      uint32
+	done      chan struct{}
+}
+
+func newBackendPool(key string, bs backendSettings, urls []*url.URL, logger Logger) *backendPool {
+	pool := &backendPool{
+		key:      key,
+		settings: bs,
+		logger:   logger,
+		client:   &http.Client{Timeout: bs.Timeout},
+		done:     make(chan struct{}),
+	}
+	for _, u := range urls {
+		pool.endpoints = append(pool.endpoints, &backendEndpoint{url: u})
+	}
+	if bs.HealthPath != "" {
+		go pool.healthCheck()
+	}
+	return pool
+}
+
+func (pool *backendPool) stop() {
+	close(pool.done)
+}
+
+// healthCheck 每healthInterval请求一次healthPath，2xx为健康
+func (pool *backendPool) healthCheck() {
+	interval := pool.settings.HealthInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	client := &http.Client{Timeout: interval}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for _, e := range pool.endpoints {
+			healthy := false
+			if resp, err := client.Get(e.url.String() + pool.settings.HealthPath); err == nil {
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+				healthy = resp.StatusCode >= 200 && resp.StatusCode < 300
+			}
+			if healthy {
+				atomic.StoreInt32(&e.unhealthy, 0)
+			} else {
+				atomic.StoreInt32(&e.unhealthy, 1)
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-pool.done:
+			return
+		}
+	}
+}
+
+// pick 按balance选择地址，全部不健康时在全部地址中选择
+func (pool *backendPool) pick(tried map[*backendEndpoint]bool) *backendEndpoint {
+	var candidates []*backendEndpoint
+	for _, e := range pool.endpoints {
+		if !tried[e] && atomic.LoadInt32(&e.unhealthy) == 0 {
+			candidates = append(candidates, e)
+		}
+	}
+	if len(candidates) == 0 {
+		for _, e := range pool.endpoints {
+			if !tried[e] {
+				candidates = append(candidates, e)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	if pool.settings.Balance == "random" {
+		return candidates[rand.Intn(len(candidates))]
+	}
+	return candidates[int(atomic.AddUint32(&pool.next, 1)-1)%len(candidates)]
+}
+
+// JSONCall POST args到后端，连接失败时换一个地址重试，请求已发出后不重试
+//
+// queue为module_version，与MQ相同
+func (pool *backendPool) JSONCall(queue, serviceMethod string, args *[]byte, reply *[]byte, isChildCall ...bool) error {
+	module, version := queue, ""
+	if i := strings.Index(queue, "_"); i >= 0 {
+		module, version = queue[:i], queue[i+1:]
+	}
+	path := strings.NewReplacer(
+		"{module}", url.PathEscape(module),
+		"{version}", url.PathEscape(version),
+		"{method}", url.PathEscape(serviceMethod),
+	).Replace(pool.settings.Path)
+
+	tried := map[*backendEndpoint]bool{}
+	var lastErr error
+	for e := pool.pick(tried); e != nil; e = pool.pick(tried) {
+		tried[e] = true
+		resp, err := pool.client.Post(e.url.String()+path, "application/json", bytes.NewReader(*args))
+		if err != nil {
+			lastErr = err
+			var opErr *net.OpError
+			if errors.As(err, &opErr) && opErr.Op == "dial" {
+				if pool.settings.HealthPath != "" {
+					// 由健康检查恢复
+					atomic.StoreInt32(&e.unhealthy, 1)
+				}
+				continue
+			}
+			return fmt.Errorf("backend %s: %w", serviceMethod, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("backend %s: %w", serviceMethod, err)
+		}
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			// body可能包含堆栈、内部地址，只写日志，不返回客户端
+			pool.logger.Println("backend", queue, serviceMethod, resp.Status, truncateUTF8(strings.TrimSpace(string(body)), maxBackendErrorLen))
+			return fmt.Errorf("backend %s: %s", serviceMethod, resp.Status)
+		}
+		*reply = body
+		return nil
+	}
+	return fmt.Errorf("backend %s: %w", serviceMethod, lastErr)
+}
+
+// closeBackends 停止全部健康检查
+func (g *Gateway) closeBackends() {
+	g.backendsMutex.Lock()
+	defer g.backendsMutex.Unlock()
+	for section, pool := range g.backends {
+		if pool != nil {
+			pool.stop()
+		}
+		delete(g.backends, section)
+	}
+}
+
+// truncateUTF8 截断到最多n字节，不截断在UTF-8字符中间
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
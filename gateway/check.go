@@ -0,0 +1,117 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/haierspi/pt-gateway/utils/config"
+)
+
+// CheckSettings 校验网关的全部配置，收集所有问题一起返回，用于check-config和重新加载前的校验
+func CheckSettings(c *config.Checker) error {
+	var gc gatewayConfig
+	c.Unmarshal("gateway", &gc)
+	if gc.Timeout <= 0 {
+		c.Add(&config.OptionError{Section: "gateway", Option: "timeout", Message: "must be positive"})
+	}
+	c.Optional("gateway", "exposePolicy", oneOf("enforce", "log"))
+	c.Optional("gateway", "openapi", checkBool)
+	c.Optional("gateway", "trustedProxies", checkIPList)
+	c.Optional("gateway", "mirrorStats", checkBool)
+	if gc.MirrorConcurrency <= 0 {
+		c.Add(&config.OptionError{Section: "gateway", Option: "mirrorConcurrency", Message: "must be positive"})
+	}
+	if gc.SchemaDir != "" {
+		if _, err := loadSchemas(gc.SchemaDir); err != nil {
+			c.Add(err)
+		}
+	}
+	c.Optional("gateway", "blobRoot", func(val string) error {
+		info, err := os.Stat(val)
+		if err == nil && !info.IsDir() {
+			err = errors.New("not a directory")
+		}
+		return err
+	})
+	c.Optional("jwt", "jwksTTL", checkDuration)
+	c.Optional("jwt", "leeway", checkDuration)
+	c.Optional("introspection", "cacheTTL", checkDuration)
+	var rs recordSettings
+	c.Unmarshal("record", &rs)
+	c.Optional("record", "sampleRate", checkRate)
+	if rs.MaxBodyBytes <= 0 {
+		c.Add(&config.OptionError{Section: "record", Option: "maxBodyBytes", Message: "must be positive"})
+	}
+
+	providers := make([]string, 0, len(authProviders))
+	for name := range authProviders {
+		providers = append(providers, name)
+	}
+	for _, section := range c.Sections() {
+		if strings.HasPrefix(section, "backend:") {
+			checkBackend(c, section)
+			continue
+		}
+		if section != "route" && !strings.HasPrefix(section, "route:") {
+			continue
+		}
+		c.Optional(section, "corsCredentials", checkBool)
+		c.Optional(section, "corsMaxAge", checkInt)
+		c.Optional(section, "jsonp", checkBool)
+		c.Optional(section, "httpReply", checkBool)
+		c.Optional(section, "allowIPs", checkIPList)
+		c.Optional(section, "denyIPs", checkIPList)
+		c.Optional(section, "clientCert", oneOf("optional", "required"))
+		c.Optional(section, "auth", checkAuthPolicy)
+		c.Optional(section, "authProvider", oneOf(providers...))
+		c.Optional(section, "expose", checkBool)
+		c.Optional(section, "record", checkBool)
+		c.Optional(section, "mirror", checkMirror)
+		c.Optional(section, "mirrorRate", checkRate)
+		c.Optional(section, "sign", oneOf("optional", "required"))
+		c.Optional(section, "modes", func(val string) error {
+			for _, mode := range splitList(val) {
+				if err := oneOf(allModes...)(mode); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	return c.Err()
+}
+
+func oneOf(vals ...string) func(val string) error {
+	return func(val string) error {
+		for _, v := range vals {
+			if v == val {
+				return nil
+			}
+		}
+		return fmt.Errorf("expect one of %s, got %s", strings.Join(vals, ","), val)
+	}
+}
+
+// checkAuthPolicy auth不区分大小写
+func checkAuthPolicy(val string) error {
+	return oneOf("none", "optional", "required")(strings.ToLower(val))
+}
+
+func checkBool(val string) error {
+	_, err := strconv.ParseBool(val)
+	return err
+}
+
+func checkInt(val string) error {
+	_, err := strconv.ParseInt(val, 10, 64)
+	return err
+}
+
+func checkDuration(val string) error {
+	_, err := time.ParseDuration(val)
+	return err
+}
@@ -0,0 +1,50 @@
+package gateway_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/haierspi/pt-gateway/gateway"
+	"github.com/haierspi/pt-gateway/utils/config"
+)
+
+func checkSettings(t *testing.T, cfg string) error {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "config.cfg")
+	if err := os.WriteFile(file, []byte(cfg), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return gateway.CheckSettings(config.NewChecker(file))
+}
+
+func TestCheckSettings(t *testing.T) {
+	tests := []struct {
+		name  string
+		extra string
+		want  string // 为空时应通过
+	}{
+		{"base", "", ""},
+		{"auth case-insensitive", "auth=Required\n", ""},
+		{"auth typo", "auth=requried\n", "auth"},
+		{"timeout zero", "\n[gateway]\ntimeout=0\n", "timeout: must be positive"},
+		{"timeout negative", "\n[gateway]\ntimeout=-1\n", "timeout: must be positive"},
+		{"mirrorConcurrency zero", "\n[gateway]\nmirrorConcurrency=0\n", "mirrorConcurrency: must be positive"},
+		{"maxBodyBytes zero", "\n[record]\nmaxBodyBytes=0\n", "maxBodyBytes: must be positive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkSettings(t, baseConfig+tt.extra)
+			if tt.want == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("CheckSettings() error = %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
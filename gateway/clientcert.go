@@ -0,0 +1,50 @@
+package gateway
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"time"
+)
+
+// clientCertKey bizContent中的保留字段，客户端证书通过验证时由网关写入
+const clientCertKey = "ClientCert"
+
+// clientCertInfo 写入bizContent的客户端证书信息
+type clientCertInfo struct {
+	Subject        string
+	CommonName     string
+	Issuer         string
+	SerialNumber   string
+	DNSNames       []string `json:",omitempty"`
+	EmailAddresses []string `json:",omitempty"`
+	NotAfter       time.Time
+	Fingerprint    string // 证书DER的SHA-256，hex
+}
+
+// setClientCert 客户端证书通过验证时写入bizContent的ClientCert字段
+//
+// 路由配置clientCert=required时必须有通过验证的客户端证书
+func (g *Gateway) setClientCert(r *http.Request, module, version, method string, bizContent map[string]interface{}) (code int64, message string) {
+	// 客户端不能自己传ClientCert
+	delete(bizContent, clientCertKey)
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		cert := r.TLS.VerifiedChains[0][0]
+		fingerprint := sha256.Sum256(cert.Raw)
+		bizContent[clientCertKey] = &clientCertInfo{
+			Subject:        cert.Subject.String(),
+			CommonName:     cert.Subject.CommonName,
+			Issuer:         cert.Issuer.String(),
+			SerialNumber:   cert.SerialNumber.String(),
+			DNSNames:       cert.DNSNames,
+			EmailAddresses: cert.EmailAddresses,
+			NotAfter:       cert.NotAfter,
+			Fingerprint:    hex.EncodeToString(fingerprint[:]),
+		}
+		return 0, ""
+	}
+	if g.routeString(module, version, method, "clientCert", "optional") == "required" {
+		return 5006, "缺少客户端证书"
+	}
+	return 0, ""
+}
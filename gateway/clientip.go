@@ -0,0 +1,121 @@
+package gateway
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/haierspi/pt-gateway/utils/config"
+)
+
+// ipList CIDR列表，单个IP按/32或/128处理
+type ipList []*net.IPNet
+
+// parseIPList 解析CIDR或IP列表，跳过空项
+func parseIPList(entries []string) (ipList, error) {
+	var list ipList
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, ipNet)
+	}
+	return list, nil
+}
+
+func (list ipList) contains(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range list {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// getTrustedProxies [gateway] trustedProxies，只有来自这些地址的转发头才可信，默认只信任本机
+func (g *Gateway) getTrustedProxies() ipList {
+	return g.loadIPList(config.StringDefault(g.configFile, "gateway", "trustedProxies", "127.0.0.0/8,::1/128"))
+}
+
+// parseNode 解析地址，支持带端口、[IPv6]:port、IPv6 zone，无法解析返回nil
+func parseNode(node string) net.IP {
+	node = strings.Trim(strings.TrimSpace(node), `"`)
+	if strings.HasPrefix(node, "[") {
+		if end := strings.Index(node, "]"); end > 0 {
+			node = node[1:end]
+		}
+	} else if strings.Count(node, ":") == 1 {
+		node = node[:strings.Index(node, ":")]
+	}
+	if i := strings.Index(node, "%"); i > 0 {
+		node = node[:i]
+	}
+	return net.ParseIP(node)
+}
+
+// forwardedFor RFC 7239 Forwarded头中的for，按从客户端到代理的顺序
+func forwardedFor(header string) []string {
+	var nodes []string
+	for _, element := range strings.Split(header, ",") {
+		for _, pair := range strings.Split(element, ";") {
+			kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+			if len(kv) == 2 && strings.EqualFold(kv[0], "for") {
+				nodes = append(nodes, kv[1])
+			}
+		}
+	}
+	return nodes
+}
+
+// getClientIP 客户端IP
+//
+// 直连地址不在trustedProxies时直接使用，否则按Forwarded、X-Forwarded-For、X-Real-IP的顺序，
+// 从右往左跳过可信代理，第一个不可信的地址就是客户端
+func (g *Gateway) getClientIP(req *http.Request) string {
+	remoteIP := parseNode(req.RemoteAddr)
+	if remoteIP == nil {
+		return req.RemoteAddr
+	}
+	trusted := g.getTrustedProxies()
+	if !trusted.contains(remoteIP) {
+		return remoteIP.String()
+	}
+
+	var nodes []string
+	if forwarded := req.Header.Values("Forwarded"); len(forwarded) > 0 {
+		nodes = forwardedFor(strings.Join(forwarded, ","))
+	} else if xff := req.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		nodes = strings.Split(strings.Join(xff, ","), ",")
+	} else if realIP := req.Header.Get("X-Real-IP"); realIP != "" {
+		nodes = []string{realIP}
+	}
+
+	clientIP := remoteIP
+	for i := len(nodes) - 1; i >= 0; i-- {
+		ip := parseNode(nodes[i])
+		if ip == nil {
+			// unknown、_hidden等无法识别的地址，停在最后一个可信代理
+			break
+		}
+		clientIP = ip
+		if !trusted.contains(ip) {
+			break
+		}
+	}
+	return clientIP.String()
+}
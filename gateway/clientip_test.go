@@ -0,0 +1,113 @@
+package gateway
+
+import (
+	"io"
+	"log"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseNode(t *testing.T) {
+	tests := []struct {
+		node, want string
+	}{
+		{"192.0.2.1", "192.0.2.1"},
+		{"192.0.2.1:8080", "192.0.2.1"},
+		{"2001:db8::1", "2001:db8::1"},
+		{"[2001:db8::1]", "2001:db8::1"},
+		{"[2001:db8::1]:443", "2001:db8::1"},
+		{`"[2001:db8::1]:443"`, "2001:db8::1"},
+		{"fe80::1%eth0", "fe80::1"},
+		{"[fe80::1%eth0]:80", "fe80::1"},
+		{" 192.0.2.1 ", "192.0.2.1"},
+		{"unknown", ""},
+		{"_hidden", ""},
+		{"", ""},
+		{"[2001:db8::1", ""},
+	}
+	for _, tt := range tests {
+		got := parseNode(tt.node)
+		if (got == nil && tt.want != "") || (got != nil && !got.Equal(net.ParseIP(tt.want))) {
+			t.Errorf("parseNode(%q) = %v, want %q", tt.node, got, tt.want)
+		}
+	}
+}
+
+func TestForwardedFor(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []string
+	}{
+		{"for=192.0.2.60;proto=http;by=203.0.113.43", []string{"192.0.2.60"}},
+		{`for=192.0.2.43, for="[2001:db8:cafe::17]:4711"`, []string{"192.0.2.43", `"[2001:db8:cafe::17]:4711"`}},
+		{"For=192.0.2.1;proto=https, FOR=198.51.100.1", []string{"192.0.2.1", "198.51.100.1"}},
+		{"proto=https;by=203.0.113.43", nil},
+		{"for=unknown", []string{"unknown"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := forwardedFor(tt.header); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("forwardedFor(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestGetClientIP(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.cfg")
+	cfg := "[gateway]\nlisten=:0\ndebug=false\nsignKey=KEY\ntimeout=5\ntrustedProxies=10.0.0.0/8,::1\n"
+	if err := os.WriteFile(file, []byte(cfg), 0600); err != nil {
+		t.Fatal(err)
+	}
+	g, err := New(Options{ConfigFile: file, Caller: nopCaller{}, Logger: log.New(io.Discard, "", 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	tests := []struct {
+		name    string
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{"direct", "203.0.113.9:5000", nil, "203.0.113.9"},
+		{"untrusted remote ignores headers", "203.0.113.9:5000", map[string]string{"X-Forwarded-For": "192.0.2.1"}, "203.0.113.9"},
+		{"trusted proxy without headers", "10.0.0.1:5000", nil, "10.0.0.1"},
+		{"xff", "10.0.0.1:5000", map[string]string{"X-Forwarded-For": "192.0.2.1"}, "192.0.2.1"},
+		// 最左边的地址由客户端伪造，从右往左第一个不可信的地址才是客户端
+		{"spoofed leftmost xff", "10.0.0.1:5000", map[string]string{"X-Forwarded-For": "1.1.1.1, 192.0.2.1, 10.0.0.2"}, "192.0.2.1"},
+		{"all trusted", "10.0.0.1:5000", map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"unknown node stops", "10.0.0.1:5000", map[string]string{"X-Forwarded-For": "192.0.2.1, unknown, 10.0.0.2"}, "10.0.0.2"},
+		{"forwarded before xff", "10.0.0.1:5000", map[string]string{
+			"Forwarded":       `for=192.0.2.7;proto=https, for="[::1]:80"`,
+			"X-Forwarded-For": "192.0.2.99",
+		}, "192.0.2.7"},
+		{"forwarded ipv6", "[::1]:5000", map[string]string{"Forwarded": `for="[2001:db8:cafe::17]:4711"`}, "2001:db8:cafe::17"},
+		{"forwarded hidden", "10.0.0.1:5000", map[string]string{"Forwarded": "for=_hidden"}, "10.0.0.1"},
+		{"x-real-ip", "10.0.0.1:5000", map[string]string{"X-Real-IP": "192.0.2.5"}, "192.0.2.5"},
+		{"ipv6 remote", "[2001:db8::2]:443", map[string]string{"X-Forwarded-For": "192.0.2.1"}, "2001:db8::2"},
+		{"bad remote", "pipe", nil, "pipe"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/gateway/", nil)
+			r.RemoteAddr = tt.remote
+			for key, val := range tt.headers {
+				r.Header.Set(key, val)
+			}
+			if got := g.getClientIP(r); got != tt.want {
+				t.Fatalf("getClientIP() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+type nopCaller struct{}
+
+func (nopCaller) JSONCall(queue, serviceMethod string, args *[]byte, reply *[]byte, isChildCall ...bool) error {
+	return nil
+}
@@ -0,0 +1,137 @@
+package gateway
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// corsPolicy 路由的CORS配置
+//
+//	corsOrigins=https://*.example.com,https://example.com  允许的Origin，*为全部，通配符只匹配域名的一级
+//	corsMethods=GET,POST
+//	corsHeaders=Content-Type,Authorization  *为请求的全部头
+//	corsExposeHeaders=X-Request-Id
+//	corsCredentials=true
+//	corsMaxAge=600
+type corsPolicy struct {
+	origins       []string
+	methods       []string
+	headers       []string
+	exposeHeaders []string
+	credentials   bool
+	maxAge        int64
+}
+
+func (g *Gateway) getCORSPolicy(module, version, method string) *corsPolicy {
+	policy := &corsPolicy{
+		origins:       g.routeStringSlice(module, version, method, "corsOrigins"),
+		methods:       g.routeStringSlice(module, version, method, "corsMethods"),
+		headers:       g.routeStringSlice(module, version, method, "corsHeaders"),
+		exposeHeaders: g.routeStringSlice(module, version, method, "corsExposeHeaders"),
+		credentials:   g.routeBool(module, version, method, "corsCredentials", false),
+		maxAge:        g.routeInt64(module, version, method, "corsMaxAge", 0),
+	}
+	if len(policy.methods) == 0 {
+		policy.methods = []string{"GET", "POST"}
+	}
+	return policy
+}
+
+func (policy *corsPolicy) allowOrigin(origin string) bool {
+	for _, pattern := range policy.origins {
+		if pattern == "*" || strings.EqualFold(pattern, origin) || matchOrigin(strings.ToLower(pattern), strings.ToLower(origin)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchOrigin 按域名的每一级匹配通配符，*只匹配一级：https://*.example.com匹配https://a.example.com，
+// 不匹配https://a.b.example.com和https://example.com
+func matchOrigin(pattern, origin string) bool {
+	if !strings.Contains(pattern, "*") {
+		return false
+	}
+	patternLabels, originLabels := strings.Split(pattern, "."), strings.Split(origin, ".")
+	if len(patternLabels) != len(originLabels) {
+		return false
+	}
+	for i, label := range patternLabels {
+		if originLabels[i] == "" || strings.HasSuffix(originLabels[i], "//") {
+			return false
+		}
+		if ok, _ := path.Match(label, originLabels[i]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (policy *corsPolicy) allowMethod(method string) bool {
+	for _, m := range policy.methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// setOriginHeaders 设置Access-Control-Allow-Origin等，Origin不允许时返回false
+func (policy *corsPolicy) setOriginHeaders(header http.Header, origin string) bool {
+	header.Add("Vary", "Origin")
+	if origin == "" || !policy.allowOrigin(origin) {
+		return false
+	}
+	// 带凭证时不能用*，只能回写请求的Origin
+	if len(policy.origins) == 1 && policy.origins[0] == "*" && !policy.credentials {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+	if policy.credentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+	return true
+}
+
+// setCORSHeaders 普通请求的CORS响应头
+func (g *Gateway) setCORSHeaders(header http.Header, r *http.Request, module, version, method string) {
+	policy := g.getCORSPolicy(module, version, method)
+	if policy.setOriginHeaders(header, r.Header.Get("Origin")) && len(policy.exposeHeaders) > 0 {
+		header.Set("Access-Control-Expose-Headers", strings.Join(policy.exposeHeaders, ", "))
+	}
+}
+
+// handlePreflight 处理OPTIONS预检请求，不请求后端
+func (g *Gateway) handlePreflight(w http.ResponseWriter, r *http.Request, module, version, method string) {
+	policy := g.getCORSPolicy(module, version, method)
+	header := w.Header()
+	requestMethod := r.Header.Get("Access-Control-Request-Method")
+	if requestMethod == "" {
+		// 不是预检请求
+		header.Set("Allow", strings.Join(append(policy.methods, "OPTIONS"), ", "))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	header.Add("Vary", "Access-Control-Request-Method")
+	header.Add("Vary", "Access-Control-Request-Headers")
+	if !policy.setOriginHeaders(header, r.Header.Get("Origin")) || !policy.allowMethod(requestMethod) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	header.Set("Access-Control-Allow-Methods", strings.Join(policy.methods, ", "))
+	if len(policy.headers) == 1 && policy.headers[0] == "*" {
+		if requestHeaders := r.Header.Get("Access-Control-Request-Headers"); requestHeaders != "" {
+			header.Set("Access-Control-Allow-Headers", requestHeaders)
+		}
+	} else if len(policy.headers) > 0 {
+		header.Set("Access-Control-Allow-Headers", strings.Join(policy.headers, ", "))
+	}
+	if policy.maxAge > 0 {
+		header.Set("Access-Control-Max-Age", strconv.FormatInt(policy.maxAge, 10))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
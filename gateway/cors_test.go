@@ -0,0 +1,32 @@
+package gateway
+
+import "testing"
+
+func TestAllowOrigin(t *testing.T) {
+	policy := &corsPolicy{origins: []string{"https://*.example.com", "https://example.org", "http://localhost:*"}}
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://app.example.com", true},
+		{"https://APP.Example.com", true},
+		{"https://a.b.example.com", false},
+		{"https://example.com", false},
+		{"https://.example.com", false},
+		{"http://app.example.com", false},
+		{"https://app.example.com.evil.com", false},
+		{"https://appexample.com", false},
+		{"https://example.org", true},
+		{"https://www.example.org", false},
+		{"http://localhost:8080", true},
+		{"http://localhost", false},
+	}
+	for _, tt := range tests {
+		if got := policy.allowOrigin(tt.origin); got != tt.want {
+			t.Errorf("allowOrigin(%q) = %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+	if !(&corsPolicy{origins: []string{"*"}}).allowOrigin("https://a.b.example.com") {
+		t.Error("* should allow every origin")
+	}
+}
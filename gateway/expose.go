@@ -0,0 +1,71 @@
+package gateway
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/haierspi/pt-gateway/utils/config"
+)
+
+// exposedSection 对外开放方法的配置段，只有方法级别的段才能开放方法
+//
+//	[route:examples_1.0_Examples.Echo]
+//	expose=true
+//	modes=default,r      允许的请求方式：default、b、f、r、u，不配置为全部
+//	sign=required        必须签名
+//	auth=required
+func exposedSection(module, version, method string) string {
+	return "route:" + module + "_" + version + "_" + method
+}
+
+// exposedMethod 对外开放的方法
+type exposedMethod struct {
+	module  string
+	version string
+	method  string
+	modes   []string
+}
+
+// allModes 全部请求方式
+var allModes = []string{modeDefault, modeBody, modeForm, modeRaw, modeURL}
+
+// exposedMethods 按配置段顺序列出全部开放的方法，module中不能有_
+func (g *Gateway) exposedMethods() []exposedMethod {
+	var methods []exposedMethod
+	for _, section := range config.Sections(g.configFile) {
+		if !strings.HasPrefix(section, "route:") {
+			continue
+		}
+		names := strings.SplitN(strings.TrimPrefix(section, "route:"), "_", 3)
+		if len(names) != 3 {
+			continue
+		}
+		if exposed, _ := strconv.ParseBool(config.StringDefault(g.configFile, section, "expose", "")); !exposed {
+			continue
+		}
+		modes := splitList(config.StringDefault(g.configFile, section, "modes", ""))
+		if len(modes) == 0 {
+			modes = allModes
+		}
+		methods = append(methods, exposedMethod{module: names[0], version: names[1], method: names[2], modes: modes})
+	}
+	return methods
+}
+
+// checkExposed 默认拒绝未开放的方法，[gateway] exposePolicy=log时只记录不拒绝，用于迁移
+func (g *Gateway) checkExposed(mode, module, version, method, sign string) (code int64, message string) {
+	section := exposedSection(module, version, method)
+	if exposed, _ := strconv.ParseBool(config.StringDefault(g.configFile, section, "expose", "")); !exposed {
+		code, message = 5001, fmt.Sprintf("请求方法错误:%s", method)
+	} else if modes := config.StringDefault(g.configFile, section, "modes", ""); modes != "" && !containsAny(splitList(modes), []string{mode}) {
+		code, message = 5001, fmt.Sprintf("请求方式错误:%s", method)
+	} else if sign == "" && config.StringDefault(g.configFile, section, "sign", "") == "required" {
+		code, message = 5002, "签名错误:缺少签名"
+	}
+	if code != 0 && config.StringDefault(g.configFile, "gateway", "exposePolicy", "enforce") == "log" {
+		g.logger.Println("expose violation:", mode, module, version, method, message)
+		return 0, ""
+	}
+	return code, message
+}
@@ -0,0 +1,573 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/haierspi/pt-gateway/utils/jsonschema"
+	"github.com/haierspi/pt-gateway/utils/jwt"
+	"github.com/haierspi/pt-gateway/utils/ptjson"
+	"github.com/haierspi/pt-gateway/utils/rpc"
+	"github.com/haierspi/pt-gateway/utils/sign"
+)
+
+// 请求方式，对应/gateway/后的路径，默认方式为/gateway/
+const (
+	modeDefault = "default"
+	modeBody    = "b"
+	modeForm    = "f"
+	modeRaw     = "r"
+	modeURL     = "u"
+)
+
+// Caller 调用后端服务，*rpc.Client实现了该接口
+type Caller interface {
+	JSONCall(queue, serviceMethod string, args *[]byte, reply *[]byte, isChildCall ...bool) error
+}
+
+// SignVerifier 验证默认方式的签名，返回错误信息，通过时为空
+type SignVerifier func(r *http.Request, signKey string) (message string)
+
+// Logger 请求和错误日志，*log.Logger实现了该接口
+type Logger interface {
+	Println(v ...interface{})
+}
+
+// Options 创建Gateway的参数
+type Options struct {
+	ConfigFile   string       // 配置文件，默认./config.cfg
+	Caller       Caller       // 必填
+	SignVerifier SignVerifier // 默认VerifySign
+	Logger       Logger       // 默认log包的标准Logger
+}
+
+// Gateway 把HTTP请求转换为后端调用，路由配置每次请求时读取，[gateway]中的配置由Reload加载
+type Gateway struct {
+	configFile string
+	caller     Caller
+	verifySign SignVerifier
+	logger     Logger
+
+	settingsMutex     sync.RWMutex
+	listen            string
+	debug             bool
+	signKey           string
+	timeout           time.Duration
+	schemas           map[string]*jsonschema.Schema
+	mirrorConcurrency int64
+	record            recordSettings
+
+	backendsMutex sync.RWMutex
+	backends      map[string]*backendPool // key为[backend:…]配置段，type不是http时为nil
+
+	ipListsMutex sync.Mutex
+	ipLists      map[string]*ipListSource // key为IP列表的配置值
+
+	keySetsMutex sync.Mutex
+	keySets      map[string]*jwt.KeySet // key为[jwt] jwks
+
+	introspectionMutex  sync.Mutex
+	introspectionCache  map[string]*introspectionEntry // key为token
+	introspectionSwept  time.Time
+	introspectionClient *http.Client
+
+	blobClient *http.Client // 下载http(s)的BodyRef
+
+	recordWriter recordWriter
+
+	mirrorMutex    sync.Mutex
+	mirrors        map[string]*mirrorCounter // key为module_version_method
+	mirrorInflight atomic.Int64
+}
+
+// Resp 响应
+type Resp struct {
+	ErrorCode int64
+	ErrorMsg  string
+	Errors    []jsonschema.FieldError `json:",omitempty"` // bizContent校验失败的字段
+}
+
+// New 创建Gateway并加载[gateway]配置
+func New(opts Options) (*Gateway, error) {
+	if opts.Caller == nil {
+		return nil, errors.New("gateway: Caller is required")
+	}
+	g := &Gateway{
+		configFile: opts.ConfigFile,
+		caller:     opts.Caller,
+		verifySign: opts.SignVerifier,
+		logger:     opts.Logger,
+		schemas:    map[string]*jsonschema.Schema{},
+		backends:   map[string]*backendPool{},
+		ipLists:    map[string]*ipListSource{},
+		mirrors:    map[string]*mirrorCounter{},
+
+		introspectionClient: &http.Client{Timeout: 10 * time.Second},
+		blobClient: &http.Client{
+			Transport: &http.Transport{
+				Proxy:                 http.ProxyFromEnvironment,
+				ResponseHeaderTimeout: 20 * time.Second,
+			},
+		},
+	}
+	if g.configFile == "" {
+		g.configFile = "./config.cfg"
+	}
+	if g.verifySign == nil {
+		g.verifySign = VerifySign
+	}
+	if g.logger == nil {
+		g.logger = log.Default()
+	}
+	if err := g.Reload(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Close 停止HTTP后端的健康检查，关闭记录文件
+func (g *Gateway) Close() {
+	g.recordWriter.close()
+	g.closeBackends()
+}
+
+// ServeHTTP 按路径分发到各请求方式
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	if r.Method == http.MethodOptions {
+		g.gatewayOptions(w, r, path)
+		return
+	}
+	if path == "/gateway/openapi.json" || path == "/gateway/docs" || path == "/gateway/docs/" {
+		g.gatewayOpenAPI(w, r, path)
+		return
+	}
+	if path == "/gateway/mirror.json" {
+		g.gatewayMirrorStats(w, r)
+		return
+	}
+	r = g.startRecord(r)
+	if path == "/gateway" || path == "/gateway/" {
+		g.gatewayDefault(w, r)
+		return
+	}
+	if strings.Index(path, "/gateway/b/") == 0 { // 场景微信支付
+		g.gatewayBody(w, r, path[11:])
+		return
+	}
+	if strings.Index(path, "/gateway/f/") == 0 { // 场景支付宝支付
+		g.gatewayForm(w, r, path[11:])
+		return
+	}
+	if strings.Index(path, "/gateway/r/") == 0 {
+		g.gatewayRaw(w, r, path[11:])
+		return
+	}
+	if strings.Index(path, "/gateway/u/") == 0 { // 场景如图片
+		g.gatewayURL(w, r, path[11:])
+		return
+	}
+
+}
+
+// OPTIONS预检请求，按路由的CORS配置直接响应，不请求后端
+//
+// module、version、method取自路径，/gateway/则取自query
+func (g *Gateway) gatewayOptions(w http.ResponseWriter, r *http.Request, path string) {
+	var module, version, method string
+	if len(path) > 11 && strings.Index(path, "/gateway/") == 0 && path[10] == '/' {
+		module, version, method, _, _ = _handPath(path[11:])
+	} else {
+		query := r.URL.Query()
+		module, version, method = query.Get("module"), query.Get("version"), query.Get("method")
+	}
+	g.handlePreflight(w, r, module, version, method)
+}
+
+// body字符串，成为bizContent的Body字段，用于post body回调，比如微信支付
+//
+// url: /gateway/b/m/examples_1.0_Examples.Echo
+//
+// body: 任意文本
+//
+// bizContent
+//
+//	{"Body":"任意文本"}
+//
+// 必须返回
+//
+//	{
+//	   "Body": "<xml></xml>",
+//	   "ContentType": "text/xml"
+//	}
+func (g *Gateway) gatewayBody(w http.ResponseWriter, r *http.Request, path string) {
+	// 公共参数
+	module, version, method, callBack, _ := _handPath(path)
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		g.logger.Println(err)
+	} else {
+		r.Body.Close()
+	}
+
+	bizContentData := map[string]interface{}{
+		"Body":     string(body),
+		"ClientIP": g.getClientIP(r),
+	}
+	g._callAPI(module, version, method, callBack, "", "", modeBody, bizContentData, w, r, nil)
+}
+
+// bizContent在form中，用于post Form回调，比如支付宝支付
+//
+// url: /gateway/f/m/examples_1.0_Examples.Echo
+//
+// 表单: kv
+//
+// bizContent,kv都是字符串
+//
+//	{"key":"value"}
+//
+// 必须返回结构
+//
+//	{
+//	   "Body": "<xml></xml>",
+//	   "ContentType": "text/xml"
+//	}
+func (g *Gateway) gatewayForm(w http.ResponseWriter, r *http.Request, path string) {
+	// 公共参数
+	module, version, method, callBack, _ := _handPath(path)
+
+	// bizContent
+	var err error
+	requestContentType := r.Header.Get("Content-Type")
+	if strings.Index(requestContentType, "multipart/form-data") != -1 {
+		err = r.ParseMultipartForm(32 << 20)
+	} else {
+		err = r.ParseForm()
+	}
+
+	formValues := r.Form
+	bizContentData := map[string]interface{}{}
+	for key, val := range formValues {
+		bizContentData[key] = val[0]
+	}
+	bizContentData["ClientIP"] = g.getClientIP(r)
+	g._callAPI(module, version, method, callBack, "", "", modeForm, bizContentData, w, r, err)
+}
+
+// body字符串是json，解析为bizContent
+//
+// url: /gateway/r/m/examples_1.0_Examples.Echo
+//
+// body: json object 字符串
+//
+// 返回 任意数据
+func (g *Gateway) gatewayRaw(w http.ResponseWriter, r *http.Request, path string) {
+	// 公共参数
+	module, version, method, callBack, _ := _handPath(path)
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		g.logger.Println(err)
+	} else {
+		r.Body.Close()
+	}
+
+	// bizContent
+	var bizContentData map[string]interface{}
+	err = ptjson.Unmarshal(body, &bizContentData)
+	if bizContentData == nil {
+		bizContentData = map[string]interface{}{}
+	}
+
+	bizContentData["ClientIP"] = g.getClientIP(r)
+	g._callAPI(module, version, method, callBack, "", "", modeRaw, bizContentData, w, r, err)
+}
+
+// body字符串是json，解析为bizContent
+//
+// url: /gateway/u/m/examples_1.0_Examples.Echo/b/{"Body":"hahaha"}
+//
+// body: json object 字符串
+//
+// 必须返回结构，图片等二进制内容Body为base64，或者用BodyRef引用
+//
+//	{
+//	   "Body": "iVBORw0KGgo...",
+//	   "ContentType": "image/png",
+//	   "FileName": "a.png",
+//	   "Inline": true,
+//	   "MaxAge": 86400
+//	}
+func (g *Gateway) gatewayURL(w http.ResponseWriter, r *http.Request, path string) {
+	// 公共参数
+	module, version, method, callBack, bizContent := _handPath(path)
+
+	// bizContent
+	var bizContentData map[string]interface{}
+	err := ptjson.Unmarshal([]byte(bizContent), &bizContentData)
+	if bizContentData == nil {
+		bizContentData = map[string]interface{}{}
+	}
+
+	bizContentData["ClientIP"] = g.getClientIP(r)
+	g._callAPI(module, version, method, callBack, "", "", modeURL, bizContentData, w, r, err)
+}
+
+func _handPath(path string) (module, version, method, callBack, bizContent string) {
+	paths := strings.Split(path, "/")
+	lenPaths := len(paths)
+	params := map[string]string{}
+	if lenPaths%2 == 0 {
+		for i := 0; i < lenPaths/2; i++ {
+			params[paths[i*2]] = paths[i*2+1]
+		}
+	}
+	m := params["m"]
+	methodInfos := strings.Split(m, "|")
+	if len(methodInfos) == 3 {
+		module = methodInfos[0]
+		version = methodInfos[1]
+		method = methodInfos[2]
+	}
+	callBack = params["c"]
+	bizContent = params["b"]
+	return
+}
+
+// 所有数据均在query中
+//
+// url: /gateway/
+//
+// 表单或者query:
+//
+// module:examples
+//
+// version:1.0
+//
+// method:Examples.Echo
+//
+// bizContent:{"Body":"hahaha"}
+//
+// 返回 任意数据
+func (g *Gateway) gatewayDefault(w http.ResponseWriter, r *http.Request) {
+	var err error
+	requestContentType := r.Header.Get("Content-Type")
+	if strings.Index(requestContentType, "multipart/form-data") != -1 {
+		err = r.ParseMultipartForm(32 << 20)
+	} else {
+		err = r.ParseForm()
+	}
+	if err != nil {
+		g.logger.Println(err)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	formValues := r.Form
+
+	// 公共参数
+	module := formValues.Get("module")
+	version := formValues.Get("version")
+	method := formValues.Get("method")
+	sign := formValues.Get("sign")
+	callBack := formValues.Get("callback")
+
+	// bizContent
+	var bizContentData map[string]interface{}
+	err = ptjson.Unmarshal([]byte(formValues.Get("bizContent")), &bizContentData)
+	if bizContentData == nil {
+		bizContentData = map[string]interface{}{}
+	}
+	bizContentData["ClientIP"] = g.getClientIP(r)
+	signMessage := ""
+	if sign != "" {
+		signMessage = g.verifySign(r, g.getSignKey())
+	}
+
+	g._callAPI(module, version, method, callBack, sign, signMessage, modeDefault, bizContentData, w, r, err)
+}
+
+func (g *Gateway) _callAPI(module, version, method, callBack, sign, signMessage, mode string, bizContent map[string]interface{}, w http.ResponseWriter, r *http.Request, err error) {
+	var reply = &[]byte{}  //存正确的返回
+	var result = new(Resp) //存错误的返回
+	var start = time.Now()
+	var isBody = mode == modeBody || mode == modeForm || mode == modeURL
+	var sent []byte          // 发给后端的bizContent
+	var routeMethod = method // 路由配置使用的方法名，签名请求的method之后会加上WithSign
+
+	defer func(errRelsult *Resp, rightResult *[]byte) {
+		var r1 []byte
+		var bodyReply rpc.BodyReply
+		var httpReply *rpc.HTTPReply
+		var blob io.ReadCloser
+		var blobSize int64
+		if result.ErrorCode == 0 && isBody {
+			err := ptjson.Unmarshal(*rightResult, &bodyReply)
+			if err != nil {
+				g.logger.Println(err)
+			}
+			if bodyReply.BodyRef != "" {
+				blob, blobSize, err = g.openBlob(bodyReply.BodyRef)
+				if err != nil {
+					g.logger.Println(module, method, version, err)
+					result.ErrorCode = 5003
+					result.ErrorMsg = "读取内容失败:" + err.Error()
+				} else {
+					defer blob.Close()
+				}
+			}
+		}
+		if result.ErrorCode != 0 {
+			w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+			r1, _ = ptjson.PrettyMarshal(errRelsult)
+		} else if isBody {
+			setBodyReplyHeaders(w.Header(), &bodyReply)
+			r1 = bodyReply.Body
+			httpReply = bodyReply.HTTP
+		} else {
+			w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+			r1 = *rightResult
+			// 路由配置httpReply=true时才处理顶层的"HTTP"字段，避免改动已有后端的回复
+			if g.routeBool(module, version, routeMethod, "httpReply", false) {
+				httpReply, r1 = g.extractHTTPReply(*rightResult)
+			}
+		}
+		g.setCORSHeaders(w.Header(), r, module, version, routeMethod)
+		statusCode := http.StatusOK
+		if httpReply != nil {
+			statusCode = g.applyHTTPReply(w.Header(), httpReply)
+		}
+		if blob != nil {
+			if blobSize >= 0 {
+				w.Header().Set("Content-Length", strconv.FormatInt(blobSize, 10))
+			}
+			w.WriteHeader(statusCode)
+			if _, err := io.Copy(w, blob); err != nil {
+				g.logger.Println(module, method, version, err)
+			}
+		} else {
+			if callBack != "" {
+				r1 = wrapJSONP(w.Header(), callBack, r1)
+			}
+			w.Header().Set("Content-Length", strconv.Itoa(len(r1)))
+			w.WriteHeader(statusCode)
+			w.Write(r1)
+		}
+		// BodyRef和二进制的BodyReply不记录响应，JSON中的字符串只能保存UTF-8文本
+		if blob != nil || !isTextContentType(w.Header().Get("Content-Type")) || !utf8.Valid(r1) {
+			r1 = nil
+		}
+		g.finishRecord(r, mode, module, version, method, sent, result, *reply, r1, statusCode, start)
+
+		if g.isDebug() {
+			g.logger.Println(time.Now().Sub(start), module, method, version, bizContent, " replay:", string(*reply))
+		} else {
+			g.logger.Println(time.Now().Sub(start), module, method, version, bizContent)
+		}
+	}(result, reply)
+
+	if callBack != "" {
+		if message := g.checkCallback(callBack, isBody, module, version, method); message != "" {
+			callBack = "" // 不合法的回调名不能输出
+			result.ErrorCode = 5004
+			result.ErrorMsg = message
+			return
+		}
+	}
+
+	clientIP, _ := bizContent["ClientIP"].(string)
+	if message := g.checkIP(clientIP, module, version, method); message != "" {
+		result.ErrorCode = 5005
+		result.ErrorMsg = message
+		return
+	}
+
+	if code, message := g.checkExposed(mode, module, version, method, sign); code != 0 {
+		result.ErrorCode = code
+		result.ErrorMsg = message
+		return
+	}
+
+	if code, message := g.setClientCert(r, module, version, method, bizContent); code != 0 {
+		result.ErrorCode = code
+		result.ErrorMsg = message
+		return
+	}
+
+	if code, message := g.authenticate(r, module, version, method, bizContent); code != 0 {
+		result.ErrorCode = code
+		result.ErrorMsg = message
+		return
+	}
+
+	if err != nil {
+		result.ErrorCode = 5000
+		result.ErrorMsg = "form表单错误:" + err.Error()
+		return
+	}
+
+	if errs := g.validateBizContent(module, version, method, bizContent); len(errs) > 0 {
+		result.ErrorCode = 5008
+		result.ErrorMsg = "参数错误"
+		result.Errors = errs
+		return
+	}
+
+	if strings.Contains(method, "WithSign") {
+		result.ErrorCode = 5001
+		result.ErrorMsg = fmt.Sprintf("请求方法错误:%s", method)
+		return
+	}
+	if sign != "" {
+		if signMessage != "" {
+			result.ErrorCode = 5002
+			result.ErrorMsg = "签名错误:" + signMessage
+			return
+		}
+		method = method + "WithSign"
+	}
+
+	b, _ := ptjson.Marshal(bizContent)
+	sent = b
+	callStart := time.Now()
+	err = g.backendCaller(module, version).JSONCall(fmt.Sprintf("%s_%s", module, version), method, &b, reply)
+	g.mirror(module, version, method, b, *reply, err, time.Since(callStart))
+	if err != nil {
+		if strings.Contains(err.Error(), "cannot unmarshal") {
+			g.logger.Println(module, method, version, bizContent, err.Error())
+		}
+		result.ErrorCode = 5003
+		result.ErrorMsg = strings.Replace(err.Error(), "WithSign", "", -1)
+	}
+}
+
+// VerifySign 默认的签名验证，算法见sign.Sign，timestamp前后5分钟内有效
+func VerifySign(req *http.Request, signKey string) (message string) {
+	req.ParseForm()
+	var urls url.Values
+	if req.Method == "POST" {
+		urls = req.Form
+	} else {
+		urls = req.URL.Query()
+	}
+
+	if sign.Expired(urls.Get("timestamp"), time.Now(), 5*time.Minute) {
+		message = "请求已过期"
+	} else if urls.Get("sign") != sign.Sign(urls, signKey) {
+		message = "签名失败,拿掉签名试试"
+	}
+	return
+}
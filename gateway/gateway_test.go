@@ -0,0 +1,515 @@
+package gateway_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/haierspi/pt-gateway/gateway"
+	"github.com/haierspi/pt-gateway/utils/config"
+	"github.com/haierspi/pt-gateway/utils/sign"
+)
+
+const baseConfig = `[gateway]
+listen=127.0.0.1:0
+debug=false
+signKey=KEY
+timeout=5
+exposePolicy=enforce
+
+[route:examples_1.0_Examples.Echo]
+expose=true
+corsOrigins=https://app.example.com
+`
+
+const httpReplyBody = `{"HTTP":{"StatusCode":302,"Location":"https://x"},"A":"<b>&"}`
+
+// call 后端收到的一次调用
+type call struct {
+	Queue      string
+	Method     string
+	BizContent map[string]interface{}
+}
+
+// fakeCaller 记录调用，返回bizContent；方法名以Fail开头时返回错误
+type fakeCaller struct {
+	mutex sync.Mutex
+	calls []call
+}
+
+func (c *fakeCaller) JSONCall(queue, serviceMethod string, args *[]byte, reply *[]byte, isChildCall ...bool) error {
+	var bizContent map[string]interface{}
+	if err := json.Unmarshal(*args, &bizContent); err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	c.calls = append(c.calls, call{queue, serviceMethod, bizContent})
+	c.mutex.Unlock()
+	if strings.HasPrefix(serviceMethod, "Fail") {
+		return errors.New("backend failed")
+	}
+	// 带顶层HTTP字段的回复
+	if strings.HasPrefix(serviceMethod, "HTTP") {
+		*reply = []byte(httpReplyBody)
+		return nil
+	}
+	// 二进制的BodyReply
+	if strings.HasPrefix(serviceMethod, "Binary") {
+		*reply, _ = json.Marshal(map[string]interface{}{"Body": []byte{0x89, 'P', 'N', 'G', 0xff, 0xfe}, "ContentType": "image/png"})
+		return nil
+	}
+	// 认证服务，用户为队列名
+	if serviceMethod == "Auth.Introspect" {
+		*reply, _ = json.Marshal(map[string]interface{}{"active": true, "sub": queue})
+		return nil
+	}
+	*reply, _ = json.Marshal(map[string]interface{}{"Echo": bizContent})
+	return nil
+}
+
+func (c *fakeCaller) last(t *testing.T) call {
+	t.Helper()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if len(c.calls) == 0 {
+		t.Fatal("backend not called")
+	}
+	return c.calls[len(c.calls)-1]
+}
+
+func newGateway(t *testing.T, cfg string) (*gateway.Gateway, *fakeCaller) {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "config.cfg")
+	if err := os.WriteFile(file, []byte(cfg), 0600); err != nil {
+		t.Fatal(err)
+	}
+	caller := &fakeCaller{}
+	g, err := gateway.New(gateway.Options{
+		ConfigFile: file,
+		Caller:     caller,
+		Logger:     log.New(io.Discard, "", 0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(g.Close)
+	return g, caller
+}
+
+func serve(g *gateway.Gateway, r *http.Request) (*httptest.ResponseRecorder, map[string]interface{}) {
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, r)
+	var body map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	return w, body
+}
+
+func defaultURL(method, bizContent string) string {
+	values := url.Values{"module": {"examples"}, "version": {"1.0"}, "method": {method}, "bizContent": {bizContent}}
+	return "/gateway/?" + values.Encode()
+}
+
+func signedValues(method, bizContent, key string) url.Values {
+	values := url.Values{
+		"module":     {"examples"},
+		"version":    {"1.0"},
+		"method":     {method},
+		"bizContent": {bizContent},
+		"timestamp":  {sign.Timestamp(time.Now())},
+	}
+	values.Set("sign", sign.Sign(values, key))
+	return values
+}
+
+func TestServeHTTPDefault(t *testing.T) {
+	g, caller := newGateway(t, baseConfig)
+	w, body := serve(g, httptest.NewRequest("GET", defaultURL("Examples.Echo", `{"Name":"a"}`), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	got := caller.last(t)
+	if got.Queue != "examples_1.0" || got.Method != "Examples.Echo" || got.BizContent["Name"] != "a" {
+		t.Fatalf("backend call = %+v", got)
+	}
+	// ClientIP由网关写入
+	if got.BizContent["ClientIP"] != "192.0.2.1" {
+		t.Fatalf("ClientIP = %v", got.BizContent["ClientIP"])
+	}
+	if echo, _ := body["Echo"].(map[string]interface{}); echo["Name"] != "a" {
+		t.Fatalf("response = %s", w.Body)
+	}
+}
+
+func TestServeHTTPErrors(t *testing.T) {
+	g, _ := newGateway(t, baseConfig+`
+[route:examples_1.0_FailEcho]
+expose=true
+`)
+	tests := []struct {
+		name string
+		url  string
+		code float64
+	}{
+		{"not exposed", defaultURL("Examples.Hidden", `{}`), 5001},
+		{"WithSign in method", defaultURL("Examples.EchoWithSign", `{}`), 5001},
+		{"bad bizContent", defaultURL("Examples.Echo", `{`), 5000},
+		{"backend error", defaultURL("FailEcho", `{}`), 5003},
+		{"bad sign", "/gateway/?" + signedValues("Examples.Echo", `{}`, "WRONG").Encode(), 5002},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, body := serve(g, httptest.NewRequest("GET", tt.url, nil))
+			if body["ErrorCode"] != tt.code {
+				t.Fatalf("ErrorCode = %v, want %v: %v", body["ErrorCode"], tt.code, body["ErrorMsg"])
+			}
+		})
+	}
+}
+
+func TestServeHTTPSigned(t *testing.T) {
+	g, caller := newGateway(t, baseConfig)
+	r := httptest.NewRequest("POST", "/gateway/", strings.NewReader(signedValues("Examples.Echo", `{"Name":"a"}`, "KEY").Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Origin", "https://app.example.com")
+	w, body := serve(g, r)
+	if _, ok := body["ErrorCode"]; ok {
+		t.Fatalf("response = %s", w.Body)
+	}
+	if got := caller.last(t); got.Method != "Examples.EchoWithSign" {
+		t.Fatalf("method = %s, want Examples.EchoWithSign", got.Method)
+	}
+	// 方法级别的CORS配置对签名请求同样生效
+	if origin := w.Header().Get("Access-Control-Allow-Origin"); origin != "https://app.example.com" {
+		t.Fatalf("Access-Control-Allow-Origin = %q", origin)
+	}
+}
+
+func TestServeHTTPBody(t *testing.T) {
+	g, caller := newGateway(t, baseConfig)
+	r := httptest.NewRequest("POST", "/gateway/b/m/examples|1.0|Examples.Echo", strings.NewReader("<xml/>"))
+	serve(g, r)
+	if got := caller.last(t); got.BizContent["Body"] != "<xml/>" {
+		t.Fatalf("bizContent = %v", got.BizContent)
+	}
+}
+
+// 多个Gateway的配置互不影响
+func TestServeHTTPIndependentInstances(t *testing.T) {
+	denied, _ := newGateway(t, baseConfig+"denyIPs=192.0.2.0/24\n")
+	allowed, _ := newGateway(t, baseConfig)
+	_, body := serve(denied, httptest.NewRequest("GET", defaultURL("Examples.Echo", `{}`), nil))
+	if body["ErrorCode"] != float64(5005) {
+		t.Fatalf("denied ErrorCode = %v", body["ErrorCode"])
+	}
+	_, body = serve(allowed, httptest.NewRequest("GET", defaultURL("Examples.Echo", `{}`), nil))
+	if _, ok := body["ErrorCode"]; ok {
+		t.Fatalf("allowed ErrorCode = %v", body["ErrorCode"])
+	}
+}
+
+// [backend:…]在Reload时生效，删除或改为amqp后使用Options.Caller
+func TestReloadBackends(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Backend":"http"}`))
+	}))
+	defer backend.Close()
+	file := filepath.Join(t.TempDir(), "config.cfg")
+	write := func(cfg string) {
+		if err := os.WriteFile(file, []byte(cfg), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := config.Reload(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(baseConfig + "\n[backend:examples]\ntype=http\nurls=" + backend.URL + "\n")
+	caller := &fakeCaller{}
+	g, err := gateway.New(gateway.Options{ConfigFile: file, Caller: caller, Logger: log.New(io.Discard, "", 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	_, body := serve(g, httptest.NewRequest("GET", defaultURL("Examples.Echo", `{}`), nil))
+	if body["Backend"] != "http" {
+		t.Fatalf("response = %v", body)
+	}
+
+	for _, cfg := range []string{baseConfig + "\n[backend:examples]\ntype=amqp\n", baseConfig} {
+		write(cfg)
+		if err := g.Reload(); err != nil {
+			t.Fatal(err)
+		}
+		_, body = serve(g, httptest.NewRequest("GET", defaultURL("Examples.Echo", `{}`), nil))
+		if _, ok := body["Echo"]; !ok {
+			t.Fatalf("response = %v, want Options.Caller", body)
+		}
+	}
+
+	write(baseConfig + "\n[backend:examples]\ntype=http\nurls=tcp://x\n")
+	if err := g.Reload(); err == nil || !strings.Contains(err.Error(), "urls") {
+		t.Fatalf("Reload() error = %v, want urls error", err)
+	}
+}
+
+// Reload后丢弃缓存的introspection结果，修改的queue立即生效
+func TestReloadIntrospection(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.cfg")
+	write := func(queue string) {
+		cfg := baseConfig + "auth=required\nauthProvider=introspection\n\n[introspection]\nqueue=" + queue + "\n"
+		if err := os.WriteFile(file, []byte(cfg), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := config.Reload(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("auth_1.0")
+	g, err := gateway.New(gateway.Options{ConfigFile: file, Caller: &fakeCaller{}, Logger: log.New(io.Discard, "", 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	user := func() interface{} {
+		r := httptest.NewRequest("GET", defaultURL("Examples.Echo", `{}`), nil)
+		r.Header.Set("Authorization", "Bearer token")
+		w, body := serve(g, r)
+		echo, _ := body["Echo"].(map[string]interface{})
+		auth, _ := echo["Auth"].(map[string]interface{})
+		if auth == nil {
+			t.Fatalf("response = %s", w.Body)
+		}
+		return auth["UserID"]
+	}
+
+	if got := user(); got != "auth_1.0" {
+		t.Fatalf("UserID = %v", got)
+	}
+	write("auth_2.0")
+	if got := user(); got != "auth_1.0" {
+		t.Fatalf("UserID before Reload = %v, want cached auth_1.0", got)
+	}
+	if err := g.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got := user(); got != "auth_2.0" {
+		t.Fatalf("UserID after Reload = %v", got)
+	}
+}
+
+// 二进制回复不记录响应，文本回复按原样记录
+func TestRecordBinaryResponse(t *testing.T) {
+	recordFile := filepath.Join(t.TempDir(), "record.jsonl")
+	g, _ := newGateway(t, baseConfig+`
+[route:examples_1.0_BinaryEcho]
+expose=true
+
+[record]
+file=`+recordFile+"\n")
+	for _, r := range []*http.Request{
+		httptest.NewRequest("POST", "/gateway/b/m/examples|1.0|BinaryEcho", strings.NewReader("x")),
+		httptest.NewRequest("GET", defaultURL("Examples.Echo", `{"Body":"x"}`), nil),
+	} {
+		if w, _ := serve(g, r); w.Code != http.StatusOK {
+			t.Fatalf("%s status = %d", r.URL, w.Code)
+		}
+	}
+	g.Close()
+
+	data, err := os.ReadFile(recordFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("records = %d, want 2", len(lines))
+	}
+	var binary, text gateway.Record
+	if err := json.Unmarshal([]byte(lines[0]), &binary); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &text); err != nil {
+		t.Fatal(err)
+	}
+	if binary.Response != "" || binary.StatusCode != http.StatusOK {
+		t.Fatalf("binary record = %+v", binary)
+	}
+	if !strings.Contains(text.Response, `"Body":"x"`) {
+		t.Fatalf("text record = %+v", text)
+	}
+}
+
+// 顶层的HTTP字段只在httpReply=true时处理，否则原样返回
+func TestServeHTTPReply(t *testing.T) {
+	g, _ := newGateway(t, baseConfig+`
+[route:examples_1.0_HTTPPlain]
+expose=true
+
+[route:examples_1.0_HTTPRedirect]
+expose=true
+httpReply=true
+`)
+	w, _ := serve(g, httptest.NewRequest("GET", defaultURL("HTTPPlain", `{}`), nil))
+	if w.Code != http.StatusOK || w.Body.String() != httpReplyBody {
+		t.Fatalf("plain = %d %s", w.Code, w.Body)
+	}
+	w, _ = serve(g, httptest.NewRequest("GET", defaultURL("HTTPRedirect", `{}`), nil))
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "https://x" || w.Body.String() != `{"A":"<b>&"}` {
+		t.Fatalf("redirect = %d %v %s", w.Code, w.Header(), w.Body)
+	}
+}
+
+// auth只接受none、optional、required（不区分大小写），写错时按required处理
+func TestServeHTTPAuthPolicy(t *testing.T) {
+	tests := []struct {
+		auth string
+		code interface{}
+	}{
+		{"none", nil},
+		{"Optional", nil},
+		{"REQUIRED", float64(5006)},
+		{"requried", float64(5006)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.auth, func(t *testing.T) {
+			g, _ := newGateway(t, baseConfig+"auth="+tt.auth+"\n")
+			_, body := serve(g, httptest.NewRequest("GET", defaultURL("Examples.Echo", `{}`), nil))
+			if body["ErrorCode"] != tt.code {
+				t.Fatalf("ErrorCode = %v, want %v", body["ErrorCode"], tt.code)
+			}
+		})
+	}
+}
+
+// 后端的错误body只写日志，不返回客户端
+func TestBackendErrorBody(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, strings.Repeat("内部错误", 200)+" at db.internal:5432", http.StatusInternalServerError)
+	}))
+	defer backend.Close()
+	file := filepath.Join(t.TempDir(), "config.cfg")
+	cfg := baseConfig + "\n[backend:examples]\ntype=http\nurls=" + backend.URL + "\n"
+	if err := os.WriteFile(file, []byte(cfg), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var logs strings.Builder
+	g, err := gateway.New(gateway.Options{ConfigFile: file, Caller: &fakeCaller{}, Logger: log.New(&logs, "", 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	_, body := serve(g, httptest.NewRequest("GET", defaultURL("Examples.Echo", `{}`), nil))
+	message, _ := body["ErrorMsg"].(string)
+	if body["ErrorCode"] != float64(5003) || !strings.Contains(message, "500") || strings.Contains(message, "内部错误") {
+		t.Fatalf("response = %v", body)
+	}
+	if !strings.Contains(logs.String(), "内部错误") || !utf8.ValidString(logs.String()) {
+		t.Fatalf("log = %q", logs.String())
+	}
+}
+
+// 记录文件被logrotate移走后，Reload或检查到文件变化时写入新文件
+func TestRecordReopenAfterRotate(t *testing.T) {
+	recordFile := filepath.Join(t.TempDir(), "record.jsonl")
+	g, _ := newGateway(t, baseConfig+`
+[record]
+file=`+recordFile+"\n")
+	record := func() {
+		t.Helper()
+		if w, _ := serve(g, httptest.NewRequest("GET", defaultURL("Examples.Echo", `{"Body":"x"}`), nil)); w.Code != http.StatusOK {
+			t.Fatalf("status = %d", w.Code)
+		}
+	}
+	countLines := func(file string) int {
+		t.Helper()
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Count(string(data), "\n")
+	}
+
+	record()
+	if err := os.Rename(recordFile, recordFile+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	record()
+	if n := countLines(recordFile + ".1"); n != 1 {
+		t.Fatalf("rotated records = %d, want 1", n)
+	}
+	if n := countLines(recordFile); n != 1 {
+		t.Fatalf("records after Reload = %d, want 1", n)
+	}
+
+	// 不Reload，下次检查时发现文件已被移走
+	if err := os.Rename(recordFile, recordFile+".2"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	record()
+	if n := countLines(recordFile + ".2"); n != 1 {
+		t.Fatalf("rotated records = %d, want 1", n)
+	}
+	if n := countLines(recordFile); n != 1 {
+		t.Fatalf("records after rotate = %d, want 1", n)
+	}
+}
+
+// mirror.json只有POST ?reset=true才清空统计，清空后进行中的影子调用仍然计入
+func TestMirrorStatsReset(t *testing.T) {
+	cfg := strings.Replace(baseConfig, "[gateway]\n", "[gateway]\nmirrorStats=true\n", 1)
+	g, _ := newGateway(t, cfg+"mirror=examples_2.0\n")
+	call := func() {
+		t.Helper()
+		if w, _ := serve(g, httptest.NewRequest("GET", defaultURL("Examples.Echo", `{"Body":"x"}`), nil)); w.Code != http.StatusOK {
+			t.Fatalf("status = %d", w.Code)
+		}
+	}
+	waitCalls := func(want int64) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for g.MirrorStats()["examples_1.0_Examples.Echo"].Calls != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("mirror stats = %+v, want %d calls", g.MirrorStats(), want)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	call()
+	waitCalls(1)
+	w, _ := serve(g, httptest.NewRequest("GET", "/gateway/mirror.json?reset=true", nil))
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != http.MethodPost {
+		t.Fatalf("GET reset = %d %v", w.Code, w.Header())
+	}
+	waitCalls(1)
+
+	w, _ = serve(g, httptest.NewRequest("POST", "/gateway/mirror.json?reset=true", nil))
+	var stats map[string]gateway.MirrorStats
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || stats["examples_1.0_Examples.Echo"].Calls != 1 {
+		t.Fatalf("POST reset = %d %s", w.Code, w.Body)
+	}
+	if s := g.MirrorStats()["examples_1.0_Examples.Echo"]; s.Calls != 0 || s.Mirror != "examples_2.0" {
+		t.Fatalf("stats after reset = %+v", s)
+	}
+	call()
+	waitCalls(1)
+}
@@ -0,0 +1,154 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/haierspi/pt-gateway/utils/config"
+	"github.com/haierspi/pt-gateway/utils/jwt"
+	"github.com/haierspi/pt-gateway/utils/ptjson"
+)
+
+// introspectionProvider RFC 7662 token introspection，用于不透明的access token
+//
+// [introspection] url为introspection地址，或者queue、method通过rpc调用认证服务，
+// rpc参数为{"Token":"..."}，返回与RFC 7662相同的结构
+type introspectionProvider struct{}
+
+const (
+	maxIntrospectionCache      = 10000            // 缓存的token数上限，满时先清理过期的，再淘汰最早过期的
+	introspectionNegativeTTL   = 10 * time.Second // 未激活的token只短暂缓存，避免反复请求认证服务
+	introspectionSweepInterval = time.Minute      // 清理过期缓存的间隔
+)
+
+// introspectionEntry 缓存的结果，info为nil表示token未激活
+type introspectionEntry struct {
+	info    *authInfo
+	expires time.Time
+}
+
+func (introspectionProvider) authenticate(g *Gateway, token string) (*authInfo, error) {
+	now := time.Now()
+	g.introspectionMutex.Lock()
+	entry, ok := g.introspectionCache[token]
+	g.introspectionMutex.Unlock()
+	if ok && now.Before(entry.expires) {
+		if entry.info == nil {
+			return nil, errors.New("token is not active")
+		}
+		return entry.info, nil
+	}
+
+	// 请求出错不缓存
+	claims, err := g.introspect(token)
+	if err != nil {
+		return nil, err
+	}
+	if active, _ := claims["active"].(bool); !active {
+		g.cacheIntrospection(token, nil, now.Add(introspectionNegativeTTL))
+		return nil, errors.New("token is not active")
+	}
+	info := &authInfo{
+		UserID: claims.String("sub"),
+		Roles:  claims.Strings(config.StringDefault(g.configFile, "introspection", "rolesClaim", "roles")),
+		Scopes: claims.Strings("scope"),
+		Claims: claims,
+	}
+	if info.UserID == "" {
+		info.UserID = claims.String("username")
+	}
+
+	// 缓存到token过期，最长cacheTTL
+	cacheTTL, err := time.ParseDuration(config.StringDefault(g.configFile, "introspection", "cacheTTL", "300s"))
+	if err != nil {
+		cacheTTL = 300 * time.Second
+	}
+	expires := now.Add(cacheTTL)
+	if exp, ok := claims["exp"].(float64); ok && time.Unix(int64(exp), 0).Before(expires) {
+		expires = time.Unix(int64(exp), 0)
+	}
+	g.cacheIntrospection(token, info, expires)
+	return info, nil
+}
+
+// cacheIntrospection 缓存结果，每introspectionSweepInterval或者缓存满时清理过期的，仍然满时淘汰最早过期的
+func (g *Gateway) cacheIntrospection(token string, info *authInfo, expires time.Time) {
+	now := time.Now()
+	g.introspectionMutex.Lock()
+	defer g.introspectionMutex.Unlock()
+	_, exists := g.introspectionCache[token]
+	full := !exists && len(g.introspectionCache) >= maxIntrospectionCache
+	if full || now.Sub(g.introspectionSwept) >= introspectionSweepInterval {
+		for key, e := range g.introspectionCache {
+			if !now.Before(e.expires) {
+				delete(g.introspectionCache, key)
+			}
+		}
+		g.introspectionSwept = now
+	}
+	if !exists && len(g.introspectionCache) >= maxIntrospectionCache {
+		var oldest string
+		var oldestExpires time.Time
+		for key, e := range g.introspectionCache {
+			if oldest == "" || e.expires.Before(oldestExpires) {
+				oldest, oldestExpires = key, e.expires
+			}
+		}
+		delete(g.introspectionCache, oldest)
+	}
+	g.introspectionCache[token] = &introspectionEntry{info: info, expires: expires}
+}
+
+// introspect 请求introspection地址或者认证服务
+func (g *Gateway) introspect(token string) (jwt.Claims, error) {
+	var claims jwt.Claims
+	if queue := config.StringDefault(g.configFile, "introspection", "queue", ""); queue != "" {
+		method := config.StringDefault(g.configFile, "introspection", "method", "Auth.Introspect")
+		args, err := ptjson.Marshal(map[string]string{"Token": token})
+		if err != nil {
+			return nil, err
+		}
+		var reply []byte
+		if err = g.caller.JSONCall(queue, method, &args, &reply); err != nil {
+			return nil, err
+		}
+		err = ptjson.Unmarshal(reply, &claims)
+		return claims, err
+	}
+
+	endpoint := config.StringDefault(g.configFile, "introspection", "url", "")
+	if endpoint == "" {
+		return nil, errors.New("introspection not configured")
+	}
+	req, err := http.NewRequest("POST", endpoint, strings.NewReader(url.Values{
+		"token":           {token},
+		"token_type_hint": {"access_token"},
+	}.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if clientID := config.StringDefault(g.configFile, "introspection", "clientID", ""); clientID != "" {
+		req.SetBasicAuth(clientID, config.StringDefault(g.configFile, "introspection", "clientSecret", ""))
+	}
+	resp, err := g.introspectionClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("introspection: %s", resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	err = ptjson.Unmarshal(body, &claims)
+	return claims, err
+}
@@ -0,0 +1,90 @@
+package gateway
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// inactiveCaller 认证服务，所有token都未激活，记录调用次数
+type inactiveCaller struct {
+	calls atomic.Int64
+}
+
+func (c *inactiveCaller) JSONCall(queue, serviceMethod string, args *[]byte, reply *[]byte, isChildCall ...bool) error {
+	c.calls.Add(1)
+	*reply = []byte(`{"active":false}`)
+	return nil
+}
+
+func newIntrospectionGateway(t *testing.T, caller Caller) *Gateway {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "config.cfg")
+	cfg := "[gateway]\nlisten=:0\ndebug=false\nsignKey=KEY\ntimeout=5\n\n[introspection]\nqueue=auth_1.0\n"
+	if err := os.WriteFile(file, []byte(cfg), 0600); err != nil {
+		t.Fatal(err)
+	}
+	g, err := New(Options{ConfigFile: file, Caller: caller, Logger: log.New(io.Discard, "", 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(g.Close)
+	return g
+}
+
+// 未激活的token短暂缓存
+func TestIntrospectionNegativeCache(t *testing.T) {
+	caller := &inactiveCaller{}
+	g := newIntrospectionGateway(t, caller)
+	for i := 0; i < 3; i++ {
+		if _, err := (introspectionProvider{}).authenticate(g, "bad"); err == nil {
+			t.Fatal("inactive token accepted")
+		}
+	}
+	if n := caller.calls.Load(); n != 1 {
+		t.Fatalf("introspect calls = %d, want 1", n)
+	}
+	entry := g.introspectionCache["bad"]
+	if entry == nil || entry.info != nil || time.Until(entry.expires) > introspectionNegativeTTL {
+		t.Fatalf("negative entry = %+v", entry)
+	}
+}
+
+// 缓存满时先清理过期的，仍然满时淘汰最早过期的
+func TestIntrospectionCacheLimit(t *testing.T) {
+	g := newIntrospectionGateway(t, &inactiveCaller{})
+	now := time.Now()
+	info := &authInfo{UserID: "u"}
+	for i := 0; i < maxIntrospectionCache; i++ {
+		g.cacheIntrospection(fmt.Sprint("token", i), info, now.Add(time.Hour+time.Duration(i)*time.Second))
+	}
+	g.introspectionCache["token1"].expires = now.Add(-time.Second)
+
+	g.cacheIntrospection("new1", info, now.Add(time.Hour))
+	if _, ok := g.introspectionCache["token1"]; ok {
+		t.Fatal("expired entry not swept")
+	}
+	if _, ok := g.introspectionCache["token0"]; !ok {
+		t.Fatal("valid entry evicted while an expired one existed")
+	}
+	g.cacheIntrospection("new2", info, now.Add(time.Hour))
+	if len(g.introspectionCache) != maxIntrospectionCache {
+		t.Fatalf("cache size = %d, want %d", len(g.introspectionCache), maxIntrospectionCache)
+	}
+	if _, ok := g.introspectionCache["token0"]; ok {
+		t.Fatal("earliest expiring entry not evicted")
+	}
+	if _, ok := g.introspectionCache["new2"]; !ok {
+		t.Fatal("new entry not cached")
+	}
+	// 更新已有的token不淘汰
+	g.cacheIntrospection("new2", info, now.Add(2*time.Hour))
+	if _, ok := g.introspectionCache["token2"]; !ok {
+		t.Fatal("entry evicted when updating an existing token")
+	}
+}
@@ -0,0 +1,130 @@
+package gateway
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/haierspi/pt-gateway/utils/config"
+)
+
+// ipListCheckInterval 检查IP列表文件是否修改的间隔
+const ipListCheckInterval = 5 * time.Second
+
+type ipListSource struct {
+	list    ipList
+	files   map[string]time.Time // 引用的文件和修改时间
+	checked time.Time
+}
+
+// loadIPList 解析逗号分隔的IP列表配置，@开头的项为文件，每行一个CIDR，#为注释
+//
+// 按配置值缓存，文件修改后自动重新加载
+func (g *Gateway) loadIPList(raw string) ipList {
+	g.ipListsMutex.Lock()
+	defer g.ipListsMutex.Unlock()
+	source, ok := g.ipLists[raw]
+	if ok && (len(source.files) == 0 || time.Since(source.checked) < ipListCheckInterval) {
+		return source.list
+	}
+	if ok {
+		source.checked = time.Now()
+		if !filesChanged(source.files) {
+			return source.list
+		}
+	}
+
+	source = &ipListSource{files: map[string]time.Time{}, checked: time.Now()}
+	var entries []string
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if !strings.HasPrefix(entry, "@") {
+			entries = append(entries, entry)
+			continue
+		}
+		fileEntries, modTime, err := readIPListFile(entry[1:])
+		if err != nil {
+			g.logger.Println("read ip list:", err)
+		}
+		source.files[entry[1:]] = modTime
+		entries = append(entries, fileEntries...)
+	}
+	list, err := parseIPList(entries)
+	if err != nil {
+		g.logger.Println("invalid ip list:", raw, err)
+		if last, ok := g.ipLists[raw]; ok {
+			// 保留上一次正确的列表
+			list = last.list
+		}
+	}
+	source.list = list
+	g.ipLists[raw] = source
+	return list
+}
+
+func filesChanged(files map[string]time.Time) bool {
+	for file, modTime := range files {
+		info, err := os.Stat(file)
+		if err != nil || !info.ModTime().Equal(modTime) {
+			return true
+		}
+	}
+	return false
+}
+
+func readIPListFile(file string) (entries []string, modTime time.Time, err error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, modTime, err
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err == nil {
+		modTime = info.ModTime()
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		entries = append(entries, strings.Split(line, ",")...)
+	}
+	return entries, modTime, scanner.Err()
+}
+
+// checkIPList 校验IP列表配置，引用的文件必须存在
+func checkIPList(raw string) error {
+	var entries []string
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if !strings.HasPrefix(entry, "@") {
+			entries = append(entries, entry)
+			continue
+		}
+		fileEntries, _, err := readIPListFile(entry[1:])
+		if err != nil {
+			return err
+		}
+		entries = append(entries, fileEntries...)
+	}
+	_, err := parseIPList(entries)
+	return err
+}
+
+// checkIP 路由的IP黑白名单
+//
+//	allowIPs=10.0.0.0/8,@/etc/pt-gateway/wechatpay.cidr  白名单，使用最具体的一级，配置了则只允许名单内的IP
+//	denyIPs=1.2.3.4                                      黑名单，各级都生效
+func (g *Gateway) checkIP(clientIP string, module, version, method string) (message string) {
+	ip := parseNode(clientIP)
+	for _, section := range routeSections(module, version, method) {
+		if raw := config.StringDefault(g.configFile, section, "denyIPs", ""); raw != "" && g.loadIPList(raw).contains(ip) {
+			return "IP不允许访问:" + clientIP
+		}
+	}
+	if raw := g.routeString(module, version, method, "allowIPs", ""); raw != "" && !g.loadIPList(raw).contains(ip) {
+		return "IP不允许访问:" + clientIP
+	}
+	return ""
+}
@@ -0,0 +1,29 @@
+package gateway
+
+import (
+	"net/http"
+	"regexp"
+)
+
+// callbackPattern JSONP回调名，只允许js标识符，可以用.分隔，如jQuery123.cb
+var callbackPattern = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*(\.[A-Za-z_$][A-Za-z0-9_$]*)*$`)
+
+const maxCallbackLen = 128
+
+// checkCallback 校验JSONP，路由需要配置jsonp=true，且只用于json回复
+func (g *Gateway) checkCallback(callBack string, isBody bool, module, version, method string) (message string) {
+	if isBody || !g.routeBool(module, version, method, "jsonp", false) {
+		return "不支持JSONP"
+	}
+	if len(callBack) > maxCallbackLen || !callbackPattern.MatchString(callBack) {
+		return "callback参数错误"
+	}
+	return ""
+}
+
+// wrapJSONP 包装JSONP回复，/**/防止回调名被当作其他类型内容解析
+func wrapJSONP(header http.Header, callBack string, data []byte) []byte {
+	header.Set("Content-Type", "application/javascript; charset=UTF-8")
+	header.Set("X-Content-Type-Options", "nosniff")
+	return []byte("/**/" + callBack + "(" + string(data) + ");")
+}
@@ -0,0 +1,201 @@
+package gateway
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/haierspi/pt-gateway/utils/config"
+	"github.com/haierspi/pt-gateway/utils/jsondiff"
+	"github.com/haierspi/pt-gateway/utils/ptjson"
+)
+
+// 影子流量，路由配置mirror后，后端调用完成时把同样的参数异步发给mirror，回复不返回给客户端，只做统计
+//
+//	[route:orders_1.0]
+//	mirror=orders_2.0                     module_version，与MQ队列相同，也可以配置[backend:orders_2.0]
+//	mirrorRate=0.1                        0到1，默认1
+//	mirrorIgnore=Data.UpdatedAt,Data.ID   比较回复时忽略的字段，数组下标省略
+//
+// 统计见/gateway/mirror.json，[gateway] mirrorStats=true时开启；同时进行的影子调用超过[gateway] mirrorConcurrency时丢弃
+
+// maxMirrorDiffs 统计中保留的最近一次差异的字段数
+const maxMirrorDiffs = 20
+
+// MirrorStats 一个方法的影子流量统计
+type MirrorStats struct {
+	Mirror        string   // 影子后端，module_version
+	Calls         int64    // 发给影子后端的次数
+	Dropped       int64    // 超过mirrorConcurrency丢弃的次数
+	PrimaryErrors int64    // 原后端出错的次数
+	MirrorErrors  int64    // 影子后端出错的次数
+	Diffs         int64    // 都成功但回复不同的次数
+	PrimaryAvgMs  float64  // 原后端平均耗时
+	MirrorAvgMs   float64  // 影子后端平均耗时
+	MirrorMaxMs   float64  // 影子后端最大耗时
+	LastDiff      []string `json:",omitempty"` // 最近一次不同的字段
+	LastError     string   `json:",omitempty"` // 影子后端最近一次错误
+}
+
+// mirrorCounter 统计的累计值，由mirrorMutex保护
+type mirrorCounter struct {
+	stats        MirrorStats
+	primaryTotal time.Duration
+	mirrorTotal  time.Duration
+}
+
+// mirror 按路由配置把调用复制到影子后端，在原后端返回后调用，不阻塞请求
+func (g *Gateway) mirror(module, version, method string, args, reply []byte, callErr error, elapsed time.Duration) {
+	// 签名请求的method带WithSign，路由配置使用原方法名
+	routeMethod := strings.TrimSuffix(method, "WithSign")
+	target := g.routeString(module, version, routeMethod, "mirror", "")
+	if target == "" {
+		return
+	}
+	rate, err := strconv.ParseFloat(g.routeString(module, version, routeMethod, "mirrorRate", "1"), 64)
+	if err != nil || rand.Float64() >= rate {
+		return
+	}
+	counter := g.mirrorCounter(module+"_"+version+"_"+routeMethod, target)
+	if g.mirrorInflight.Add(1) > g.getMirrorConcurrency() {
+		g.mirrorInflight.Add(-1)
+		g.mirrorMutex.Lock()
+		counter.stats.Dropped++
+		g.mirrorMutex.Unlock()
+		return
+	}
+	ignore := map[string]bool{}
+	for _, field := range g.routeStringSlice(module, version, routeMethod, "mirrorIgnore") {
+		ignore[field] = true
+	}
+
+	go func() {
+		defer g.mirrorInflight.Add(-1)
+		var mirrorReply []byte
+		mirrorErr := errors.New("mirror expects module_version, got " + target)
+		start := time.Now()
+		if i := strings.Index(target, "_"); i > 0 {
+			sent := append([]byte(nil), args...)
+			mirrorErr = g.backendCaller(target[:i], target[i+1:]).JSONCall(target, method, &sent, &mirrorReply)
+		}
+		mirrorElapsed := time.Since(start)
+
+		var diffs []string
+		if callErr == nil && mirrorErr == nil {
+			var err error
+			if diffs, err = jsondiff.Diff(reply, mirrorReply, ignore); err != nil {
+				diffs = []string{"json: " + err.Error()}
+			}
+		}
+
+		g.mirrorMutex.Lock()
+		defer g.mirrorMutex.Unlock()
+		s := &counter.stats
+		s.Calls++
+		counter.primaryTotal += elapsed
+		counter.mirrorTotal += mirrorElapsed
+		s.PrimaryAvgMs = durationMs(counter.primaryTotal) / float64(s.Calls)
+		s.MirrorAvgMs = durationMs(counter.mirrorTotal) / float64(s.Calls)
+		if ms := durationMs(mirrorElapsed); ms > s.MirrorMaxMs {
+			s.MirrorMaxMs = ms
+		}
+		if callErr != nil {
+			s.PrimaryErrors++
+		}
+		if mirrorErr != nil {
+			s.MirrorErrors++
+			s.LastError = mirrorErr.Error()
+		}
+		if len(diffs) > 0 {
+			s.Diffs++
+			if len(diffs) > maxMirrorDiffs {
+				diffs = diffs[:maxMirrorDiffs]
+			}
+			s.LastDiff = diffs
+			if g.isDebug() {
+				g.logger.Println("mirror", module, method, version, "->", target, diffs)
+			}
+		}
+	}()
+}
+
+// mirrorCounter 取方法的统计，mirror修改后重新统计
+func (g *Gateway) mirrorCounter(name, target string) *mirrorCounter {
+	g.mirrorMutex.Lock()
+	defer g.mirrorMutex.Unlock()
+	counter, ok := g.mirrors[name]
+	if !ok || counter.stats.Mirror != target {
+		counter = &mirrorCounter{stats: MirrorStats{Mirror: target}}
+		g.mirrors[name] = counter
+	}
+	return counter
+}
+
+// MirrorStats 影子流量统计，key为module_version_method
+func (g *Gateway) MirrorStats() map[string]MirrorStats {
+	return g.mirrorStats(false)
+}
+
+// mirrorStats 复制统计，reset时在同一次加锁中清零。进行中的影子调用持有counter指针，所以原地清零而不是替换
+func (g *Gateway) mirrorStats(reset bool) map[string]MirrorStats {
+	g.mirrorMutex.Lock()
+	defer g.mirrorMutex.Unlock()
+	stats := make(map[string]MirrorStats, len(g.mirrors))
+	for key, counter := range g.mirrors {
+		s := counter.stats
+		s.LastDiff = append([]string(nil), s.LastDiff...)
+		stats[key] = s
+		if reset {
+			*counter = mirrorCounter{stats: MirrorStats{Mirror: s.Mirror}}
+		}
+	}
+	return stats
+}
+
+// gatewayMirrorStats /gateway/mirror.json，[gateway] mirrorStats=true时开启，POST ?reset=true返回并清空统计
+func (g *Gateway) gatewayMirrorStats(w http.ResponseWriter, r *http.Request) {
+	if enabled, _ := strconv.ParseBool(config.StringDefault(g.configFile, "gateway", "mirrorStats", "false")); !enabled {
+		http.NotFound(w, r)
+		return
+	}
+	reset, _ := strconv.ParseBool(r.URL.Query().Get("reset"))
+	if reset && r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "reset requires POST", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := ptjson.PrettyMarshal(g.mirrorStats(reset))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Write(data)
+}
+
+// checkMirror 校验mirror，用于check-config
+func checkMirror(val string) error {
+	if i := strings.Index(val, "_"); i <= 0 || i == len(val)-1 {
+		return errors.New("expect module_version, got " + val)
+	}
+	return nil
+}
+
+// checkRate 校验0到1的比例
+func checkRate(val string) error {
+	rate, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return err
+	}
+	if rate < 0 || rate > 1 {
+		return errors.New("must be between 0 and 1")
+	}
+	return nil
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
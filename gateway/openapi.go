@@ -0,0 +1,265 @@
+package gateway
+
+import (
+	_ "embed"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/haierspi/pt-gateway/utils/config"
+	"github.com/haierspi/pt-gateway/utils/ptjson"
+)
+
+//go:embed openapi.html
+var openAPIDocsHTML []byte
+
+// modeDescriptions 各请求方式的说明
+var modeDescriptions = map[string]string{
+	modeBody: "body原文作为bizContent的Body字段，返回BodyReply，用于微信支付等回调",
+	modeForm: "表单字段作为bizContent，返回BodyReply，用于支付宝支付等回调",
+	modeRaw:  "body为json object，作为bizContent，返回任意json",
+	modeURL:  "bizContent为路径中b后的json，返回BodyReply，用于图片等",
+}
+
+// openAPIDocument 根据开放的方法、请求方式、认证签名要求和schema生成OpenAPI 3文档
+func (g *Gateway) openAPIDocument() map[string]interface{} {
+	paths := map[string]interface{}{}
+	var defaultMethods []string
+	for _, m := range g.exposedMethods() {
+		for _, mode := range m.modes {
+			if mode == modeDefault {
+				defaultMethods = append(defaultMethods, m.module+"|"+m.version+"|"+m.method)
+				continue
+			}
+			if _, ok := modeDescriptions[mode]; !ok {
+				continue
+			}
+			path := "/gateway/" + mode + "/m/" + m.module + "|" + m.version + "|" + m.method
+			if mode == modeURL {
+				path += "/b/{bizContent}"
+			}
+			paths[path] = map[string]interface{}{
+				"post": g.openAPIOperation(m, mode),
+			}
+		}
+	}
+	if len(defaultMethods) > 0 {
+		paths["/gateway/"] = map[string]interface{}{
+			"post": g.openAPIDefaultOperation(defaultMethods),
+		}
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.1.0",
+		"info": map[string]interface{}{
+			"title":   config.StringDefault(g.configFile, "gateway", "title", "pt-gateway"),
+			"version": config.StringDefault(g.configFile, "gateway", "apiVersion", "1.0"),
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{
+					"type":   "http",
+					"scheme": "bearer",
+				},
+			},
+			"schemas": map[string]interface{}{
+				"Resp": map[string]interface{}{
+					"type":        "object",
+					"description": "网关或后端错误，ErrorCode不为0",
+					"properties": map[string]interface{}{
+						"ErrorCode": map[string]interface{}{"type": "integer"},
+						"ErrorMsg":  map[string]interface{}{"type": "string"},
+						"Errors": map[string]interface{}{
+							"type": "array",
+							"items": map[string]interface{}{
+								"type": "object",
+								"properties": map[string]interface{}{
+									"Field":   map[string]interface{}{"type": "string"},
+									"Message": map[string]interface{}{"type": "string"},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (g *Gateway) openAPIOperation(m exposedMethod, mode string) map[string]interface{} {
+	schema := g.getSchema(m.module + "_" + m.version + "_" + m.method)
+	operation := map[string]interface{}{
+		"operationId": m.module + "_" + m.version + "_" + m.method + "_" + mode,
+		"tags":        []string{m.module + "_" + m.version},
+		"summary":     m.method,
+		"responses":   openAPIResponses(mode),
+	}
+	description := []string{modeDescriptions[mode]}
+	if schema != nil {
+		if schema.Title != "" {
+			operation["summary"] = schema.Title
+		}
+		if schema.Description != "" {
+			description = append(description, schema.Description)
+		}
+	}
+	security, note := g.openAPISecurity(m)
+	if security != nil {
+		operation["security"] = security
+	}
+	if note != "" {
+		description = append(description, note)
+	}
+	operation["description"] = strings.Join(description, "\n\n")
+
+	bizContentSchema := interface{}(map[string]interface{}{"type": "object"})
+	if schema != nil {
+		bizContentSchema = schema
+	}
+	switch mode {
+	case modeBody:
+		operation["requestBody"] = map[string]interface{}{
+			"content": map[string]interface{}{
+				"*/*": map[string]interface{}{"schema": map[string]interface{}{"type": "string"}},
+			},
+		}
+	case modeForm:
+		operation["requestBody"] = map[string]interface{}{
+			"content": map[string]interface{}{
+				"application/x-www-form-urlencoded": map[string]interface{}{"schema": bizContentSchema},
+			},
+		}
+	case modeRaw:
+		operation["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": bizContentSchema},
+			},
+		}
+	case modeURL:
+		operation["parameters"] = []interface{}{
+			map[string]interface{}{
+				"name":        "bizContent",
+				"in":          "path",
+				"required":    true,
+				"description": "json object",
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": bizContentSchema},
+				},
+			},
+		}
+	}
+	return operation
+}
+
+// openAPIDefaultOperation /gateway/所有方法共用一个路径，方法在表单中
+func (g *Gateway) openAPIDefaultOperation(methods []string) map[string]interface{} {
+	var descriptions []string
+	for _, name := range methods {
+		names := strings.SplitN(name, "|", 3)
+		m := exposedMethod{module: names[0], version: names[1], method: names[2]}
+		line := "- " + name
+		if schema := g.getSchema(m.module + "_" + m.version + "_" + m.method); schema != nil && schema.Title != "" {
+			line += " " + schema.Title
+		}
+		if _, note := g.openAPISecurity(m); note != "" {
+			line += "（" + note + "）"
+		}
+		descriptions = append(descriptions, line)
+	}
+	return map[string]interface{}{
+		"operationId": "gateway_default",
+		"tags":        []string{"gateway"},
+		"summary":     "默认方式，公共参数和bizContent在表单或query中",
+		"description": "可用的方法（module|version|method）：\n\n" + strings.Join(descriptions, "\n"),
+		"requestBody": map[string]interface{}{
+			"content": map[string]interface{}{
+				"application/x-www-form-urlencoded": map[string]interface{}{
+					"schema": map[string]interface{}{
+						"type":     "object",
+						"required": []string{"module", "version", "method"},
+						"properties": map[string]interface{}{
+							"module":     map[string]interface{}{"type": "string"},
+							"version":    map[string]interface{}{"type": "string"},
+							"method":     map[string]interface{}{"type": "string"},
+							"bizContent": map[string]interface{}{"type": "string", "description": "json object"},
+							"timestamp":  map[string]interface{}{"type": "string", "description": "签名时必填，格式20060102150405"},
+							"sign":       map[string]interface{}{"type": "string", "description": "MD5(参数按key排序&key=signKey)大写"},
+							"callback":   map[string]interface{}{"type": "string", "description": "JSONP回调，路由需要开启jsonp"},
+						},
+					},
+				},
+			},
+		},
+		"responses": openAPIResponses(modeDefault),
+	}
+}
+
+// openAPISecurity 路由的认证和签名要求
+func (g *Gateway) openAPISecurity(m exposedMethod) (security []interface{}, note string) {
+	var notes []string
+	switch auth := g.routeString(m.module, m.version, m.method, "auth", "none"); auth {
+	case "required", "optional":
+		scopes := g.routeStringSlice(m.module, m.version, m.method, "authScopes")
+		if scopes == nil {
+			scopes = []string{}
+		}
+		security = []interface{}{map[string]interface{}{"bearerAuth": scopes}}
+		if auth == "optional" {
+			security = append(security, map[string]interface{}{})
+		}
+		notes = append(notes, "认证:"+auth)
+		if len(scopes) > 0 {
+			notes = append(notes, "scope:"+strings.Join(scopes, ","))
+		}
+	}
+	if config.StringDefault(g.configFile, exposedSection(m.module, m.version, m.method), "sign", "") == "required" {
+		notes = append(notes, "必须签名")
+	}
+	return security, strings.Join(notes, "，")
+}
+
+func openAPIResponses(mode string) map[string]interface{} {
+	content := map[string]interface{}{
+		"application/json": map[string]interface{}{
+			"schema": map[string]interface{}{
+				"oneOf": []interface{}{
+					map[string]interface{}{"type": "object", "description": "后端返回"},
+					map[string]interface{}{"$ref": "#/components/schemas/Resp"},
+				},
+			},
+		},
+	}
+	if mode == modeBody || mode == modeForm || mode == modeURL {
+		content["*/*"] = map[string]interface{}{
+			"schema": map[string]interface{}{"type": "string", "format": "binary", "description": "BodyReply.Body"},
+		}
+	}
+	return map[string]interface{}{
+		"200": map[string]interface{}{
+			"description": "成功时为后端返回，失败时为Resp",
+			"content":     content,
+		},
+	}
+}
+
+// gatewayOpenAPI /gateway/openapi.json和/gateway/docs，[gateway] openapi=true时开启
+func (g *Gateway) gatewayOpenAPI(w http.ResponseWriter, r *http.Request, path string) {
+	if enabled, _ := strconv.ParseBool(config.StringDefault(g.configFile, "gateway", "openapi", "false")); !enabled {
+		http.NotFound(w, r)
+		return
+	}
+	if path == "/gateway/openapi.json" {
+		data, err := ptjson.PrettyMarshal(g.openAPIDocument())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.Write(data)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	w.Write(openAPIDocsHTML)
+}
@@ -0,0 +1,216 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/haierspi/pt-gateway/utils/ptjson"
+)
+
+// recordSettings [record]，按sampleRate抽样记录请求和回复到file，每行一个Record，用于ptctl replay回放
+//
+//	[record]
+//	file=/var/log/pt-gateway/record.jsonl  不配置时不记录
+//	sampleRate=0.01                        0到1
+//	headers=Content-Type,User-Agent        记录的请求头，Authorization、Cookie需要时自己加上
+//	maxBodyBytes=65536                     请求body和响应超过时截断
+//
+// 路由配置record=false的方法不记录，如支付回调
+type recordSettings struct {
+	File         string   `config:"file"`
+	SampleRate   float64  `config:"sampleRate" default:"1"`
+	Headers      []string `config:"headers" default:"Content-Type,User-Agent"`
+	MaxBodyBytes int      `config:"maxBodyBytes" default:"65536"`
+}
+
+// Record 一次请求的记录
+type Record struct {
+	Time          time.Time
+	Mode          string            // default、b、f、r、u
+	HTTPMethod    string            // GET、POST
+	Path          string            // 包括query
+	Header        map[string]string `json:",omitempty"`
+	Body          string            `json:",omitempty"` // 请求body，超过maxBodyBytes时截断
+	Truncated     bool              `json:",omitempty"`
+	Module        string
+	Version       string
+	ServiceMethod string          // 调用后端的方法，签名时带WithSign
+	BizContent    json.RawMessage `json:",omitempty"` // 发给后端的参数，未调用后端时为空
+	ErrorCode     int64
+	Reply         json.RawMessage `json:",omitempty"` // 后端的回复
+	StatusCode    int
+	Response      string // 返回客户端的内容，BodyRef和非文本的Content-Type时为空，回放时只比较状态码
+	Duration      time.Duration
+}
+
+// ReplayHeader ptctl replay发送的请求带此请求头，不再记录，避免回放到同一个记录文件
+const ReplayHeader = "X-Pt-Replay"
+
+type recordKey struct{}
+
+// recording 进行中的记录，保存在请求的context中
+type recording struct {
+	settings recordSettings
+	record   Record
+	body     *limitedBuffer
+}
+
+// limitedBuffer 只保存前limit字节
+type limitedBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); room < len(p) {
+		b.truncated = true
+		if room > 0 {
+			b.Buffer.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+type teeReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// startRecord 按[record]抽样，抽中时记录请求body，返回带记录的请求
+func (g *Gateway) startRecord(r *http.Request) *http.Request {
+	rs := g.getRecordSettings()
+	if rs.File == "" || r.Header.Get(ReplayHeader) != "" {
+		return r
+	}
+	if rand.Float64() >= rs.SampleRate {
+		return r
+	}
+	rec := &recording{
+		settings: rs,
+		record: Record{
+			Time:       time.Now(),
+			HTTPMethod: r.Method,
+			Path:       r.URL.RequestURI(),
+		},
+		body: &limitedBuffer{limit: rs.MaxBodyBytes},
+	}
+	for _, name := range rs.Headers {
+		if val := r.Header.Get(name); val != "" {
+			if rec.record.Header == nil {
+				rec.record.Header = map[string]string{}
+			}
+			rec.record.Header[http.CanonicalHeaderKey(name)] = val
+		}
+	}
+	if r.Body != nil {
+		r.Body = teeReadCloser{io.TeeReader(r.Body, rec.body), r.Body}
+	}
+	return r.WithContext(context.WithValue(r.Context(), recordKey{}, rec))
+}
+
+// finishRecord 写入记录，在响应之后调用
+func (g *Gateway) finishRecord(r *http.Request, mode, module, version, method string, bizContent []byte, result *Resp, reply, response []byte, statusCode int, start time.Time) {
+	rec, ok := r.Context().Value(recordKey{}).(*recording)
+	// 签名请求的method带WithSign，路由配置使用原方法名
+	if !ok || !g.routeBool(module, version, strings.TrimSuffix(method, "WithSign"), "record", true) {
+		return
+	}
+	record := &rec.record
+	record.Mode = mode
+	record.Body = rec.body.String()
+	record.Module = module
+	record.Version = version
+	record.ServiceMethod = method
+	record.BizContent = bizContent
+	record.ErrorCode = result.ErrorCode
+	if len(reply) > 0 && json.Valid(reply) {
+		record.Reply = reply
+	}
+	record.StatusCode = statusCode
+	record.Response = string(response)
+	record.Truncated = rec.body.truncated
+	if len(record.Response) > rec.settings.MaxBodyBytes {
+		// 不截断在UTF-8字符中间
+		n := rec.settings.MaxBodyBytes
+		for n > 0 && !utf8.RuneStart(record.Response[n]) {
+			n--
+		}
+		record.Response = record.Response[:n]
+		record.Truncated = true
+	}
+	record.Duration = time.Since(start)
+
+	line, err := ptjson.Marshal(record)
+	if err != nil {
+		g.logger.Println("record:", err)
+		return
+	}
+	if err := g.recordWriter.write(rec.settings.File, append(line, '\n')); err != nil {
+		g.logger.Println("record:", err)
+	}
+}
+
+// recordCheckInterval 检查记录文件是否被轮换（移走或删除）的间隔
+const recordCheckInterval = time.Second
+
+// recordWriter 追加写入记录文件，file修改、Reload（包括SIGHUP）或者文件被logrotate移走后重新打开
+type recordWriter struct {
+	mutex   sync.Mutex
+	name    string
+	file    *os.File
+	info    os.FileInfo
+	checked time.Time
+}
+
+func (w *recordWriter) write(name string, line []byte) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.file != nil && (w.name != name || w.rotated()) {
+		w.file.Close()
+		w.file = nil
+	}
+	if w.file == nil {
+		file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+		if err != nil {
+			return err
+		}
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return err
+		}
+		w.name, w.file, w.info, w.checked = name, file, info, time.Now()
+	}
+	_, err := w.file.Write(line)
+	return err
+}
+
+// rotated 每recordCheckInterval检查一次name是否还是打开的文件
+func (w *recordWriter) rotated() bool {
+	if time.Since(w.checked) < recordCheckInterval {
+		return false
+	}
+	w.checked = time.Now()
+	info, err := os.Stat(w.name)
+	return err != nil || !os.SameFile(info, w.info)
+}
+
+func (w *recordWriter) close() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.file != nil {
+		w.file.Close()
+		w.file = nil
+	}
+}
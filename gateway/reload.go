@@ -0,0 +1,124 @@
+package gateway
+
+import (
+	"time"
+
+	"github.com/haierspi/pt-gateway/utils/config"
+	"github.com/haierspi/pt-gateway/utils/jsonschema"
+	"github.com/haierspi/pt-gateway/utils/jwt"
+)
+
+// gatewayConfig [gateway]中启动和重新加载时读取的配置
+type gatewayConfig struct {
+	Listen    string `config:"listen,required"`
+	Debug     bool   `config:"debug,required"`
+	SignKey   string `config:"signKey,required"`
+	Timeout   int64  `config:"timeout,required"`
+	SchemaDir string `config:"schemaDir"`
+	// 同时进行的影子调用上限
+	MirrorConcurrency int64 `config:"mirrorConcurrency" default:"100"`
+}
+
+// Reload 读取可以热更新的配置，New和配置文件重新加载时调用
+//
+// 路由配置每次请求时读取，重新加载后自动生效；[backend:…]在这里创建；listen需要重启
+func (g *Gateway) Reload() error {
+	var gc gatewayConfig
+	if err := config.Unmarshal(g.configFile, "gateway", &gc); err != nil {
+		return err
+	}
+	loaded := map[string]*jsonschema.Schema{}
+	if gc.SchemaDir != "" {
+		var err error
+		if loaded, err = loadSchemas(gc.SchemaDir); err != nil {
+			return err
+		}
+	}
+	if err := g.reloadBackends(time.Duration(gc.Timeout) * time.Second); err != nil {
+		return err
+	}
+	var rs recordSettings
+	if err := config.Unmarshal(g.configFile, "record", &rs); err != nil {
+		return err
+	}
+	// 重新打开记录文件，配合logrotate的SIGHUP
+	g.recordWriter.close()
+	// [jwt] jwks、jwksTTL和[introspection]可能已修改，丢弃缓存的公钥和token
+	g.keySetsMutex.Lock()
+	g.keySets = map[string]*jwt.KeySet{}
+	g.keySetsMutex.Unlock()
+	g.introspectionMutex.Lock()
+	g.introspectionCache = map[string]*introspectionEntry{}
+	g.introspectionMutex.Unlock()
+
+	g.settingsMutex.Lock()
+	if g.listen != "" && gc.Listen != g.listen {
+		g.logger.Println("gateway listen changed to", gc.Listen, ", restart to take effect")
+	} else {
+		g.listen = gc.Listen
+	}
+	g.debug, g.signKey, g.schemas = gc.Debug, gc.SignKey, loaded
+	g.timeout = time.Duration(gc.Timeout) * time.Second
+	g.mirrorConcurrency = gc.MirrorConcurrency
+	g.record = rs
+	g.settingsMutex.Unlock()
+	// *rpc.Client支持修改超时
+	if c, ok := g.caller.(interface{ SetTimeout(seconds int64) }); ok {
+		c.SetTimeout(gc.Timeout)
+	}
+	return nil
+}
+
+// Watch 监控配置文件，修改或者收到SIGHUP时校验并重新加载
+func (g *Gateway) Watch() {
+	config.OnValidate(g.configFile, CheckSettings)
+	config.Subscribe(g.configFile, func() {
+		if err := g.Reload(); err != nil {
+			g.logger.Println("gateway reload:", err)
+		}
+	})
+	config.Watch(g.configFile, 5*time.Second)
+}
+
+// Listen [gateway] listen，重新加载后不变
+func (g *Gateway) Listen() string {
+	g.settingsMutex.RLock()
+	defer g.settingsMutex.RUnlock()
+	return g.listen
+}
+
+func (g *Gateway) isDebug() bool {
+	g.settingsMutex.RLock()
+	defer g.settingsMutex.RUnlock()
+	return g.debug
+}
+
+func (g *Gateway) getSignKey() string {
+	g.settingsMutex.RLock()
+	defer g.settingsMutex.RUnlock()
+	return g.signKey
+}
+
+func (g *Gateway) getTimeout() time.Duration {
+	g.settingsMutex.RLock()
+	defer g.settingsMutex.RUnlock()
+	return g.timeout
+}
+
+func (g *Gateway) getMirrorConcurrency() int64 {
+	g.settingsMutex.RLock()
+	defer g.settingsMutex.RUnlock()
+	return g.mirrorConcurrency
+}
+
+func (g *Gateway) getRecordSettings() recordSettings {
+	g.settingsMutex.RLock()
+	defer g.settingsMutex.RUnlock()
+	return g.record
+}
+
+func (g *Gateway) getSchema(name string) *jsonschema.Schema {
+	g.settingsMutex.RLock()
+	defer g.settingsMutex.RUnlock()
+	return g.schemas[name]
+}
@@ -0,0 +1,172 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/haierspi/pt-gateway/utils/config"
+	"github.com/haierspi/pt-gateway/utils/ptjson"
+	"github.com/haierspi/pt-gateway/utils/rpc"
+)
+
+// isTextContentType 是否文本类型，文本类型才需要加charset
+func isTextContentType(contentType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	if strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+	if strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml") {
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/javascript", "application/xml", "application/x-www-form-urlencoded":
+		return true
+	}
+	return false
+}
+
+// withCharset 文本类型且未指定charset时加上UTF-8
+func withCharset(contentType string) string {
+	if isTextContentType(contentType) && !strings.Contains(strings.ToLower(contentType), "charset=") {
+		return contentType + "; charset=UTF-8"
+	}
+	return contentType
+}
+
+// setBodyReplyHeaders 根据BodyReply设置Content-Type、Content-Disposition和缓存头
+func setBodyReplyHeaders(header http.Header, bodyReply *rpc.BodyReply) {
+	if bodyReply.ContentType == "" {
+		bodyReply.ContentType = "text/plain"
+	}
+	header.Set("Content-Type", withCharset(bodyReply.ContentType))
+
+	if bodyReply.FileName != "" {
+		disposition := "attachment"
+		if bodyReply.Inline {
+			disposition = "inline"
+		}
+		header.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": bodyReply.FileName}))
+	}
+
+	if bodyReply.MaxAge > 0 {
+		header.Set("Cache-Control", fmt.Sprintf("public, max-age=%d", bodyReply.MaxAge))
+		header.Set("Expires", time.Now().Add(time.Duration(bodyReply.MaxAge)*time.Second).UTC().Format(http.TimeFormat))
+	}
+}
+
+// openBlob 打开BodyRef指向的内容，size未知时为-1
+//
+// http(s)地址直接请求，其他按[gateway] blobRoot下的相对路径读取
+func (g *Gateway) openBlob(ref string) (body io.ReadCloser, size int64, err error) {
+	if strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://") {
+		resp, err := g.blobClient.Get(ref)
+		if err != nil {
+			return nil, 0, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, 0, fmt.Errorf("blob %s: %s", ref, resp.Status)
+		}
+		return resp.Body, resp.ContentLength, nil
+	}
+
+	root := config.StringDefault(g.configFile, "gateway", "blobRoot", "")
+	if root == "" {
+		return nil, 0, errors.New("blobRoot not configured")
+	}
+	// Clean成绝对路径再拼接，防止../跳出blobRoot
+	file, err := os.Open(filepath.Join(root, filepath.Clean("/"+ref)))
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		file.Close()
+		return nil, 0, fmt.Errorf("blob %s: not a file", ref)
+	}
+	return file, info.Size(), nil
+}
+
+// extractHTTPReply 取出json回复顶层的"HTTP"字段，返回去掉该字段后的回复，只用于路由配置httpReply=true的方法
+func (g *Gateway) extractHTTPReply(reply []byte) (*rpc.HTTPReply, []byte) {
+	if !bytes.Contains(reply, []byte(`"HTTP"`)) {
+		return nil, reply
+	}
+	var fields map[string]json.RawMessage
+	if err := ptjson.Unmarshal(reply, &fields); err != nil {
+		return nil, reply
+	}
+	raw, ok := fields["HTTP"]
+	if !ok {
+		return nil, reply
+	}
+	var httpReply rpc.HTTPReply
+	if err := ptjson.Unmarshal(raw, &httpReply); err != nil {
+		g.logger.Println("invalid HTTP reply:", err)
+		return nil, reply
+	}
+	delete(fields, "HTTP")
+	stripped, err := ptjson.Marshal(fields)
+	if err != nil {
+		return nil, reply
+	}
+	return &httpReply, stripped
+}
+
+// applyHTTPReply 设置后端指定的响应头、Cookie和跳转，返回状态码
+func (g *Gateway) applyHTTPReply(header http.Header, httpReply *rpc.HTTPReply) int {
+	for key, val := range httpReply.Header {
+		switch http.CanonicalHeaderKey(key) {
+		case "Content-Length", "Transfer-Encoding", "Connection":
+			continue
+		}
+		header.Set(key, val)
+	}
+	for _, c := range httpReply.Cookies {
+		cookie := &http.Cookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Path:     c.Path,
+			Domain:   c.Domain,
+			MaxAge:   c.MaxAge,
+			Secure:   c.Secure,
+			HttpOnly: c.HttpOnly,
+		}
+		switch strings.ToLower(c.SameSite) {
+		case "lax":
+			cookie.SameSite = http.SameSiteLaxMode
+		case "strict":
+			cookie.SameSite = http.SameSiteStrictMode
+		case "none":
+			cookie.SameSite = http.SameSiteNoneMode
+		}
+		if v := cookie.String(); v != "" {
+			header.Add("Set-Cookie", v)
+		}
+	}
+
+	statusCode := httpReply.StatusCode
+	if httpReply.Location != "" {
+		header.Set("Location", httpReply.Location)
+		if statusCode == 0 {
+			statusCode = http.StatusFound
+		}
+	}
+	if statusCode != 0 && (statusCode < 100 || statusCode > 599) {
+		g.logger.Println("invalid HTTP status code:", statusCode)
+		statusCode = 0
+	}
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	return statusCode
+}
@@ -0,0 +1,75 @@
+package gateway
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/haierspi/pt-gateway/utils/config"
+)
+
+// routeSections 路由配置段，按从具体到通用的顺序：
+//
+//	[route:examples_1.0_Examples.Echo]
+//	[route:examples_1.0]
+//	[route:examples]
+//	[route]
+func routeSections(module, version, method string) []string {
+	sections := []string{"route"}
+	if module != "" {
+		sections = append(sections, "route:"+module)
+		if version != "" {
+			sections = append(sections, "route:"+module+"_"+version)
+			if method != "" {
+				sections = append(sections, "route:"+module+"_"+version+"_"+method)
+			}
+		}
+	}
+	for i, j := 0, len(sections)-1; i < j; i, j = i+1, j-1 {
+		sections[i], sections[j] = sections[j], sections[i]
+	}
+	return sections
+}
+
+// routeString 读取路由配置，越具体的段优先，都未配置时返回def
+func (g *Gateway) routeString(module, version, method, option, def string) string {
+	for _, section := range routeSections(module, version, method) {
+		if val := config.StringDefault(g.configFile, section, option, ""); val != "" {
+			return val
+		}
+	}
+	return def
+}
+
+// routeStringSlice 读取逗号分隔的路由配置
+func (g *Gateway) routeStringSlice(module, version, method, option string) []string {
+	return splitList(g.routeString(module, version, method, option, ""))
+}
+
+// splitList 按逗号分隔，去掉空白和空项
+func splitList(s string) []string {
+	var vals []string
+	for _, val := range strings.Split(s, ",") {
+		if val = strings.TrimSpace(val); val != "" {
+			vals = append(vals, val)
+		}
+	}
+	return vals
+}
+
+// routeBool 读取bool路由配置，无法解析时返回def
+func (g *Gateway) routeBool(module, version, method, option string, def bool) bool {
+	val, err := strconv.ParseBool(g.routeString(module, version, method, option, ""))
+	if err != nil {
+		return def
+	}
+	return val
+}
+
+// routeInt64 读取int路由配置，无法解析时返回def
+func (g *Gateway) routeInt64(module, version, method, option string, def int64) int64 {
+	val, err := strconv.ParseInt(g.routeString(module, version, method, option, ""), 10, 64)
+	if err != nil {
+		return def
+	}
+	return val
+}
@@ -0,0 +1,45 @@
+package gateway
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/haierspi/pt-gateway/utils/jsonschema"
+)
+
+// reservedKeys 网关写入bizContent的字段，不参与校验
+var reservedKeys = []string{"ClientIP", authKey, clientCertKey}
+
+// loadSchemas 加载dir下的schema，文件名为module_version_method.json，如examples_1.0_Examples.Echo.json
+func loadSchemas(dir string) (map[string]*jsonschema.Schema, error) {
+	loaded := map[string]*jsonschema.Schema{}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		schema, err := jsonschema.Load(file)
+		if err != nil {
+			return nil, &os.PathError{Op: "load schema", Path: file, Err: err}
+		}
+		loaded[strings.TrimSuffix(filepath.Base(file), ".json")] = schema
+	}
+	return loaded, nil
+}
+
+// validateBizContent 按方法的schema校验bizContent，没有schema时不校验
+func (g *Gateway) validateBizContent(module, version, method string, bizContent map[string]interface{}) []jsonschema.FieldError {
+	schema := g.getSchema(module + "_" + version + "_" + method)
+	if schema == nil {
+		return nil
+	}
+	data := make(map[string]interface{}, len(bizContent))
+	for key, val := range bizContent {
+		data[key] = val
+	}
+	for _, key := range reservedKeys {
+		delete(data, key)
+	}
+	return schema.Validate(data)
+}
@@ -10,10 +10,12 @@ require (
 	github.com/pborman/uuid v1.2.1
 	github.com/robfig/config v0.0.0-20141207224736-0f78529c8c7e
 	github.com/streadway/amqp v1.0.0
+	golang.org/x/net v0.35.0
 )
 
 require (
 	github.com/google/uuid v1.3.0 // indirect
 	github.com/modern-go/concurrent v0.0.0-20180228061459-e0a39a4cb421 // indirect
 	github.com/modern-go/reflect2 v1.0.2 // indirect
+	golang.org/x/text v0.22.0 // indirect
 )
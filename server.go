@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/tls"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/haierspi/pt-gateway/utils/config"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"golang.org/x/net/netutil"
+)
+
+// serverSettings [server]中HTTP服务的超时和连接限制，修改后需要重启
+type serverSettings struct {
+	ReadHeaderTimeout time.Duration `config:"readHeaderTimeout" default:"10s"`
+	ReadTimeout       time.Duration `config:"readTimeout" default:"30s"`
+	WriteTimeout      time.Duration `config:"writeTimeout" default:"60s"`
+	IdleTimeout       time.Duration `config:"idleTimeout" default:"120s"`
+	MaxHeaderBytes    int           `config:"maxHeaderBytes" default:"1048576"`
+	MaxConns          int           `config:"maxConns"`
+	HTTP2             bool          `config:"http2" default:"true"`
+	H2C               bool          `config:"h2c"`
+	MaxStreams        uint32        `config:"maxStreams" default:"250"`
+}
+
+// loadServerSettings 读取[server]配置
+func loadServerSettings(c *config.Checker) serverSettings {
+	var ss serverSettings
+	c.Unmarshal("server", &ss)
+	if ss.MaxConns < 0 {
+		c.Add(&config.OptionError{Section: "server", Option: "maxConns", Message: "must not be negative"})
+	}
+	if ss.MaxHeaderBytes <= 0 {
+		c.Add(&config.OptionError{Section: "server", Option: "maxHeaderBytes", Message: "must be positive"})
+	}
+	return ss
+}
+
+// serve 按[server]和[tls]配置监听listen
+//
+// HTTPS时通过ALPN支持HTTP/2，明文时h2c=true才支持HTTP/2（prior knowledge和Upgrade），只用于内网
+func serve(handler http.Handler) error {
+	c := config.NewChecker(configFile)
+	ss := loadServerSettings(c)
+	if err := c.Err(); err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
+
+	server := &http.Server{
+		Addr:              listenPort,
+		Handler:           handler,
+		ReadHeaderTimeout: ss.ReadHeaderTimeout,
+		ReadTimeout:       ss.ReadTimeout,
+		WriteTimeout:      ss.WriteTimeout,
+		IdleTimeout:       ss.IdleTimeout,
+		MaxHeaderBytes:    ss.MaxHeaderBytes,
+	}
+	h2Server := &http2.Server{
+		MaxConcurrentStreams: ss.MaxStreams,
+		IdleTimeout:          ss.IdleTimeout,
+	}
+	useTLS := setupTLS(server, ss.HTTP2)
+	switch {
+	case useTLS && ss.HTTP2:
+		if err := http2.ConfigureServer(server, h2Server); err != nil {
+			return err
+		}
+	case useTLS:
+		// 非nil的空map关闭HTTP/2
+		server.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+		server.TLSConfig.NextProtos = []string{"http/1.1"}
+	case ss.H2C:
+		server.Handler = h2c.NewHandler(handler, h2Server)
+	}
+
+	listener, err := net.Listen("tcp", listenPort)
+	if err != nil {
+		return err
+	}
+	if ss.MaxConns > 0 {
+		listener = netutil.LimitListener(listener, ss.MaxConns)
+	}
+	if useTLS {
+		return server.ServeTLS(listener, "", "")
+	}
+	return server.Serve(listener)
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/haierspi/pt-gateway/utils/config"
+)
+
+// tlsCheckInterval 检查证书文件是否修改的间隔
+const tlsCheckInterval = 5 * time.Second
+
+// tlsSettings [tls]配置，cert和key都配置时监听HTTPS
+type tlsSettings struct {
+	Cert       string   `config:"cert"`
+	Key        string   `config:"key"`
+	MinVersion string   `config:"minVersion" default:"1.2"`
+	Ciphers    []string `config:"ciphers"`
+	ClientCA   string   `config:"clientCA"`
+	ClientAuth string   `config:"clientAuth" default:"none"`
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+var tlsClientAuths = map[string]tls.ClientAuthType{
+	"none":          tls.NoClientCert,
+	"request":       tls.RequestClientCert,
+	"verifyIfGiven": tls.VerifyClientCertIfGiven,
+	"require":       tls.RequireAndVerifyClientCert,
+}
+
+// tlsReloader 按[tls]配置提供证书和客户端CA，配置或文件修改后自动重新加载
+//
+// 握手时只读取config，重新加载在配置订阅和后台的文件检查中进行
+type tlsReloader struct {
+	base   *tls.Config // http.Server.TLSConfig
+	http2  bool
+	config atomic.Pointer[tls.Config]
+
+	mutex    sync.Mutex // 保护settings和files，同时只进行一次加载
+	settings tlsSettings
+	files    map[string]time.Time
+}
+
+// loadTLSSettings 读取[tls]配置
+func loadTLSSettings(c *config.Checker) tlsSettings {
+	var ts tlsSettings
+	c.Unmarshal("tls", &ts)
+	return ts
+}
+
+// buildTLSConfig 读取证书和客户端CA，返回的配置不含NextProtos，http2为[server] http2
+func buildTLSConfig(ts tlsSettings, http2 bool) (cfg *tls.Config, files map[string]time.Time, err error) {
+	minVersion, ok := tlsVersions[ts.MinVersion]
+	if !ok {
+		return nil, nil, fmt.Errorf("[tls] minVersion: expect 1.0, 1.1, 1.2 or 1.3, got %s", ts.MinVersion)
+	}
+	clientAuth, ok := tlsClientAuths[ts.ClientAuth]
+	if !ok {
+		return nil, nil, fmt.Errorf("[tls] clientAuth: expect none, request, verifyIfGiven or require, got %s", ts.ClientAuth)
+	}
+	cipherSuites, err := parseCipherSuites(ts.Ciphers)
+	if err != nil {
+		return nil, nil, err
+	}
+	if http2 && minVersion < tls.VersionTLS13 && !hasHTTP2Cipher(cipherSuites) {
+		return nil, nil, errors.New("[tls] ciphers: http2 requires TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 or TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256")
+	}
+
+	files = map[string]time.Time{}
+	for _, file := range []string{ts.Cert, ts.Key, ts.ClientCA} {
+		if file == "" {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		files[file] = info.ModTime()
+	}
+	cert, err := tls.LoadX509KeyPair(ts.Cert, ts.Key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("[tls] cert/key: %w", err)
+	}
+	cfg = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   minVersion,
+		CipherSuites: cipherSuites,
+		ClientAuth:   clientAuth,
+	}
+	if ts.ClientCA != "" {
+		pem, err := os.ReadFile(ts.ClientCA)
+		if err != nil {
+			return nil, nil, err
+		}
+		cfg.ClientCAs = x509.NewCertPool()
+		if !cfg.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, nil, fmt.Errorf("[tls] clientCA: no certificate in %s", ts.ClientCA)
+		}
+	} else if clientAuth == tls.VerifyClientCertIfGiven || clientAuth == tls.RequireAndVerifyClientCert {
+		return nil, nil, errors.New("[tls] clientCA: required when clientAuth is " + ts.ClientAuth)
+	}
+	return cfg, files, nil
+}
+
+// parseCipherSuites 按名字解析TLS 1.2的加密套件，如TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256，TLS 1.3不可配置
+func parseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	suites := map[string]uint16{}
+	for _, suite := range tls.CipherSuites() {
+		suites[suite.Name] = suite.ID
+	}
+	var ids []uint16
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		id, ok := suites[name]
+		if !ok {
+			return nil, fmt.Errorf("[tls] ciphers: unknown or insecure cipher suite %s", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// hasHTTP2Cipher 是否包含HTTP/2必需的加密套件，未配置时使用Go的默认套件
+//
+// GetConfigForClient返回的配置不经过http2.ConfigureServer的检查，缺少时协商为h2后浏览器会断开连接
+func hasHTTP2Cipher(ids []uint16) bool {
+	if len(ids) == 0 {
+		return true
+	}
+	for _, id := range ids {
+		if id == tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 || id == tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 {
+			return true
+		}
+	}
+	return false
+}
+
+// reloadConfig 配置文件重新加载后调用，[tls]修改时重新读取证书，出错时保留上一次的配置
+func (t *tlsReloader) reloadConfig() {
+	var ts tlsSettings
+	if err := config.Unmarshal(configFile, "tls", &ts); err != nil {
+		log.Println("tls reload:", err)
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if ts.Cert == "" && ts.Key == "" {
+		log.Println("tls disabled in config, restart to take effect")
+		return
+	}
+	if ts.Cert == t.settings.Cert && ts.Key == t.settings.Key && ts.MinVersion == t.settings.MinVersion &&
+		strings.Join(ts.Ciphers, ",") == strings.Join(t.settings.Ciphers, ",") &&
+		ts.ClientCA == t.settings.ClientCA && ts.ClientAuth == t.settings.ClientAuth {
+		return
+	}
+	t.load(ts)
+}
+
+// watchFiles 每tlsCheckInterval检查一次证书、私钥和客户端CA的修改时间，修改后重新加载
+func (t *tlsReloader) watchFiles() {
+	for range time.Tick(tlsCheckInterval) {
+		t.mutex.Lock()
+		if filesChanged(t.files) {
+			t.load(t.settings)
+		}
+		t.mutex.Unlock()
+	}
+}
+
+// load 按ts重新读取证书，调用时持有mutex
+func (t *tlsReloader) load(ts tlsSettings) {
+	cfg, files, err := buildTLSConfig(ts, t.http2)
+	if err != nil {
+		log.Println("tls reload:", err)
+		// 文件修改前不再重试
+		t.settings, t.files = ts, currentModTimes(ts)
+		return
+	}
+	log.Println("tls reloaded:", ts.Cert)
+	t.settings, t.files = ts, files
+	t.config.Store(cfg)
+}
+
+// currentModTimes ts中文件当前的修改时间，不存在的文件记为零值
+func currentModTimes(ts tlsSettings) map[string]time.Time {
+	files := map[string]time.Time{}
+	for _, file := range []string{ts.Cert, ts.Key, ts.ClientCA} {
+		if file == "" {
+			continue
+		}
+		files[file] = time.Time{}
+		if info, err := os.Stat(file); err == nil {
+			files[file] = info.ModTime()
+		}
+	}
+	return files
+}
+
+// filesChanged 文件是否修改或删除
+func filesChanged(files map[string]time.Time) bool {
+	for file, modTime := range files {
+		info, err := os.Stat(file)
+		if err != nil || !info.ModTime().Equal(modTime) {
+			return true
+		}
+	}
+	return false
+}
+
+// getConfigForClient 每次握手使用最新的证书、客户端CA和版本策略
+func (t *tlsReloader) getConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	current := t.config.Load()
+	cfg := t.base.Clone()
+	cfg.GetConfigForClient = nil
+	cfg.GetCertificate = nil
+	cfg.Certificates = current.Certificates
+	cfg.MinVersion = current.MinVersion
+	cfg.CipherSuites = current.CipherSuites
+	cfg.ClientAuth = current.ClientAuth
+	cfg.ClientCAs = current.ClientCAs
+	return cfg, nil
+}
+
+func (t *tlsReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	current := t.config.Load()
+	if current == nil || len(current.Certificates) == 0 {
+		return nil, errors.New("tls: no certificate loaded")
+	}
+	return &current.Certificates[0], nil
+}
+
+// setupTLS [tls]配置了cert和key时为server设置TLSConfig，返回是否启用HTTPS
+func setupTLS(server *http.Server, http2 bool) bool {
+	c := config.NewChecker(configFile)
+	ts := loadTLSSettings(c)
+	if err := c.Err(); err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
+	if ts.Cert == "" && ts.Key == "" {
+		return false
+	}
+	cfg, files, err := buildTLSConfig(ts, http2)
+	if err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
+	reloader := &tlsReloader{http2: http2, settings: ts, files: files}
+	reloader.config.Store(cfg)
+	config.Subscribe(configFile, reloader.reloadConfig)
+	go reloader.watchFiles()
+	reloader.base = &tls.Config{
+		// GetConfigForClient返回的配置替换整个握手配置，需要自己声明HTTP/2
+		NextProtos:         []string{"h2", "http/1.1"},
+		MinVersion:         cfg.MinVersion,
+		GetCertificate:     reloader.getCertificate,
+		GetConfigForClient: reloader.getConfigForClient,
+	}
+	server.TLSConfig = reloader.base
+	return true
+}
+
+// checkTLS 校验[tls]配置，用于check-config
+func checkTLS(c *config.Checker, http2 bool) {
+	ts := loadTLSSettings(c)
+	if ts.Cert == "" && ts.Key == "" {
+		return
+	}
+	if _, _, err := buildTLSConfig(ts, http2); err != nil {
+		c.Add(err)
+	}
+}
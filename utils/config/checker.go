@@ -0,0 +1,139 @@
+package config
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/robfig/config"
+)
+
+// Checker 校验模式，收集全部配置问题后一起报告，不会退出
+//
+//	c := config.NewChecker("./config.cfg")
+//	listen := c.String("gateway", "listen")
+//	timeout := c.Int64("gateway", "timeout")
+//	if err := c.Err(); err != nil {
+//		fmt.Println(err)
+//	}
+type Checker struct {
+	setting  *config.Config
+	problems []string
+}
+
+// NewChecker 重新读取配置文件（不使用缓存）
+func NewChecker(configFile string) *Checker {
+	c := &Checker{}
+	setting, err := readSetting(configFile)
+	if err != nil {
+		c.problems = append(c.problems, "cannot read config file "+configFile+": "+err.Error())
+		setting = config.NewDefault()
+	}
+	c.setting = setting
+	return c
+}
+
+func newCheckerWithSetting(setting *config.Config) *Checker {
+	return &Checker{setting: setting}
+}
+
+// Lookup 读取配置项，只记录密钥引用无法解析的问题
+func (c *Checker) Lookup(section, option string) (string, bool) {
+	val, ok := c.value(section, option)
+	return val, ok && val != ""
+}
+
+// value 读取并解析密钥引用，解析失败时记录问题，ok为false
+func (c *Checker) value(section, option string) (val string, ok bool) {
+	val, err := lookupSecret(c.setting, section, option)
+	if err != nil {
+		c.Add(err)
+		return "", false
+	}
+	return val, true
+}
+
+// String 必填的字符串
+func (c *Checker) String(section, option string) string {
+	raw, ok := c.value(section, option)
+	if !ok {
+		return ""
+	}
+	val, err := parseString(raw, section, option)
+	c.Add(err)
+	return val
+}
+
+// StringDefault 可选的字符串
+func (c *Checker) StringDefault(section, option, def string) string {
+	if val, ok := c.Lookup(section, option); ok {
+		return val
+	}
+	return def
+}
+
+// Int64 必填的int
+func (c *Checker) Int64(section, option string) int64 {
+	raw, ok := c.value(section, option)
+	if !ok {
+		return 0
+	}
+	val, err := parseInt64(raw, section, option)
+	c.Add(err)
+	return val
+}
+
+// Bool 必填的bool
+func (c *Checker) Bool(section, option string) bool {
+	raw, ok := c.value(section, option)
+	if !ok {
+		return false
+	}
+	val, err := parseBool(raw, section, option)
+	c.Add(err)
+	return val
+}
+
+// JSON 必填的json object
+func (c *Checker) JSON(section, option string) []byte {
+	raw, ok := c.value(section, option)
+	if !ok {
+		return nil
+	}
+	val, err := parseJSON(raw, section, option)
+	c.Add(err)
+	return val
+}
+
+// Optional 配置了才用check校验，check返回的错误记录为该配置项的问题
+func (c *Checker) Optional(section, option string, check func(val string) error) {
+	if val, ok := c.Lookup(section, option); ok {
+		if err := check(val); err != nil {
+			c.Add(&OptionError{section, option, err.Error()})
+		}
+	}
+}
+
+// Sections 所有配置段
+func (c *Checker) Sections() []string {
+	return c.setting.Sections()
+}
+
+// Add 记录问题，err为nil时忽略
+func (c *Checker) Add(err error) {
+	if err != nil {
+		c.problems = append(c.problems, err.Error())
+	}
+}
+
+// Problems 全部问题
+func (c *Checker) Problems() []string {
+	return c.problems
+}
+
+// Err 没有问题时返回nil，否则每行一个问题
+func (c *Checker) Err() error {
+	if len(c.problems) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(c.problems, "\n"))
+}
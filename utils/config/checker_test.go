@@ -0,0 +1,84 @@
+package config
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const checkerConfig = `[gateway]
+listen=:9000
+timeout=abc
+debug=yes
+meta={"a":1}
+bad=[1
+empty=
+secret=env:PT_TEST_UNSET_SECRET
+`
+
+// 全部问题一起报告，不会退出
+func TestChecker(t *testing.T) {
+	c := NewChecker(writeFile(t, "config.cfg", checkerConfig))
+	if got := c.String("gateway", "listen"); got != ":9000" {
+		t.Fatalf("String() = %q", got)
+	}
+	c.Int64("gateway", "timeout")
+	c.Bool("gateway", "debug")
+	if got := string(c.JSON("gateway", "meta")); got != `{"a":1}` {
+		t.Fatalf("JSON() = %s", got)
+	}
+	c.JSON("gateway", "bad")
+	c.String("gateway", "empty")
+	c.String("gateway", "missing")
+	c.String("gateway", "secret")
+	if got := c.StringDefault("gateway", "empty", "def"); got != "def" {
+		t.Fatalf("StringDefault() = %q", got)
+	}
+	c.Optional("gateway", "listen", func(string) error { return errors.New("bad listen") })
+	c.Optional("gateway", "missing", func(string) error { return errors.New("not called") })
+	c.Add(nil)
+
+	want := []string{
+		"[gateway] timeout: " + msgNotInt + ", got abc",
+		"[gateway] debug: " + msgNotBool + ", got yes",
+		"[gateway] bad: " + msgNotJSON + ", got [1",
+		"[gateway] empty: " + msgEmpty,
+		"[gateway] missing: " + msgEmpty,
+		"[gateway] secret: environment variable PT_TEST_UNSET_SECRET not set",
+		"[gateway] listen: bad listen",
+	}
+	if !reflect.DeepEqual(c.Problems(), want) {
+		t.Fatalf("Problems() =\n%q\nwant\n%q", c.Problems(), want)
+	}
+	if c.Err() == nil {
+		t.Fatal("Err() = nil")
+	}
+}
+
+func TestCheckerMissingFile(t *testing.T) {
+	c := NewChecker(filepath.Join(t.TempDir(), "missing.cfg"))
+	if c.Err() == nil {
+		t.Fatal("Err() = nil for missing file")
+	}
+	if got := c.StringDefault("gateway", "listen", ":9000"); got != ":9000" {
+		t.Fatalf("StringDefault() = %q", got)
+	}
+}
+
+func TestGetErrors(t *testing.T) {
+	file := writeFile(t, "config.cfg", checkerConfig)
+	if _, err := GetInt64(file, "gateway", "timeout"); err == nil {
+		t.Fatal("GetInt64(abc) error = nil")
+	}
+	var optionErr *OptionError
+	if _, err := GetString(file, "gateway", "missing"); !errors.As(err, &optionErr) || optionErr.Message != msgEmpty {
+		t.Fatalf("GetString(missing) error = %v", err)
+	}
+	if got := Int64Default(file, "gateway", "timeout", 20); got != 20 {
+		t.Fatalf("Int64Default() = %d", got)
+	}
+	if got := BoolDefault(file, "gateway", "missing", true); !got {
+		t.Fatal("BoolDefault() = false")
+	}
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"fmt"
 	"log"
 	"strconv"
 	"strings"
@@ -15,93 +16,232 @@ var (
 	settingMap   = map[string]*config.Config{}
 )
 
+// OptionError 配置项错误
+type OptionError struct {
+	Section string
+	Option  string
+	Message string
+}
+
+func (e *OptionError) Error() string {
+	return fmt.Sprintf("[%s] %s: %s", e.Section, e.Option, e.Message)
+}
+
 // Int64 read Int64
 func Int64(configFile, section string, option string) int64 {
-	setting := getSetting(configFile)
-	s, _ := setting.String(section, option)
-
-	if s == "" {
-		log.Fatal("Configuration do not allow ", section, " ", option, " empty! ")
-	} else {
-		val, err := strconv.ParseInt(s, 10, 64)
-		if err != nil {
-			log.Fatal("Invalid configuration:", section, " ", option, s, "! Expect an int value!")
-		} else {
-			return val
-		}
+	val, err := GetInt64(configFile, section, option)
+	if err != nil {
+		log.Fatal("Invalid configuration: ", err)
 	}
-	return 0
+	return val
 }
 
 // Bool read Bool
 func Bool(configFile, section string, option string) bool {
-	setting := getSetting(configFile)
-	val, _ := setting.String(section, option)
-	switch strings.ToLower(val) {
-	case "true":
-		return true
-	case "false":
-		return false
-	case "":
-		log.Fatal("Configuration do not allow ", section, " ", option, " empty! ")
-		return false
-	default:
-		log.Fatal("Invalid bool configuration ", section, " ", option, " ", val)
-		return false
+	val, err := GetBool(configFile, section, option)
+	if err != nil {
+		log.Fatal("Invalid configuration: ", err)
 	}
+	return val
 }
 
 // String read String
 func String(configFile, section string, option string) string {
-	setting := getSetting(configFile)
-	var val string
-	val, _ = setting.String(section, option)
-	if val == "" {
-		log.Fatal("Configuration do not allow ", section, " ", option, " empty!")
-		return ""
+	val, err := GetString(configFile, section, option)
+	if err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
+	return val
+}
+
+// StringDefault read String，未配置时返回默认值def
+func StringDefault(configFile, section string, option string, def string) string {
+	setting, err := loadSetting(configFile)
+	if err != nil {
+		log.Println(err)
+		return def
+	}
+	if val := lookup(setting, section, option); val != "" {
+		return val
+	}
+	return def
+}
+
+// Int64Default read Int64，未配置或者不是int时返回默认值def
+func Int64Default(configFile, section string, option string, def int64) int64 {
+	val, err := GetInt64(configFile, section, option)
+	if err != nil {
+		if e, ok := err.(*OptionError); !ok || e.Message != msgEmpty {
+			log.Println("Invalid configuration: ", err, ", use default ", def)
+		}
+		return def
+	}
+	return val
+}
+
+// BoolDefault read Bool，未配置或者不是bool时返回默认值def
+func BoolDefault(configFile, section string, option string, def bool) bool {
+	val, err := GetBool(configFile, section, option)
+	if err != nil {
+		if e, ok := err.(*OptionError); !ok || e.Message != msgEmpty {
+			log.Println("Invalid configuration: ", err, ", use default ", def)
+		}
+		return def
 	}
 	return val
 }
 
 // StringSlice read StringSlice
 func StringSlice(configFile, section string, option string) []string {
-	setting := getSetting(configFile)
-	conf, _ := setting.String(section, option)
-	confs := strings.Split(conf, ",")
-	if len(confs) == 0 {
-		log.Fatal("Configuration do not allow ", section, " ", option, " empty!")
-		return nil
+	val, err := GetStringSlice(configFile, section, option)
+	if err != nil {
+		log.Fatal("Invalid configuration: ", err)
 	}
-	return confs
+	return val
 }
 
 // JSON read JSON
 func JSON(configFile, section string, option string) []byte {
-	setting := getSetting(configFile)
-	conf, _ := setting.String(section, option)
+	val, err := GetJSON(configFile, section, option)
+	if err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
+	return val
+}
 
-	if conf == "" {
-		log.Fatal("Configuration do not allow ", section, " ", option, " empty!")
-		return nil //never arrive here
+const (
+	msgEmpty   = "do not allow empty"
+	msgNotInt  = "expect an int value"
+	msgNotBool = "expect true or false"
+	msgNotJSON = "expect a json object"
+)
+
+// GetString 读取必填的字符串，未配置时返回*OptionError
+func GetString(configFile, section string, option string) (string, error) {
+	setting, err := loadSetting(configFile)
+	if err != nil {
+		return "", err
 	}
-	if !ptjson.IsValidJSON([]byte(conf)) {
-		log.Fatal("Invalid json configuration: ", conf, " in section ", section)
-		return nil //never arrive here
+	val, err := lookupSecret(setting, section, option)
+	if err != nil {
+		return "", err
 	}
-	return []byte(conf)
+	return parseString(val, section, option)
 }
 
-// InitConfig 初始化config
+// GetInt64 读取必填的int
+func GetInt64(configFile, section string, option string) (int64, error) {
+	setting, err := loadSetting(configFile)
+	if err != nil {
+		return 0, err
+	}
+	val, err := lookupSecret(setting, section, option)
+	if err != nil {
+		return 0, err
+	}
+	return parseInt64(val, section, option)
+}
+
+// GetBool 读取必填的bool，只接受true和false
+func GetBool(configFile, section string, option string) (bool, error) {
+	setting, err := loadSetting(configFile)
+	if err != nil {
+		return false, err
+	}
+	val, err := lookupSecret(setting, section, option)
+	if err != nil {
+		return false, err
+	}
+	return parseBool(val, section, option)
+}
+
+// GetStringSlice 读取必填的逗号分隔字符串
+func GetStringSlice(configFile, section string, option string) ([]string, error) {
+	val, err := GetString(configFile, section, option)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(val, ","), nil
+}
+
+// GetJSON 读取必填的json object
+func GetJSON(configFile, section string, option string) ([]byte, error) {
+	setting, err := loadSetting(configFile)
+	if err != nil {
+		return nil, err
+	}
+	val, err := lookupSecret(setting, section, option)
+	if err != nil {
+		return nil, err
+	}
+	return parseJSON(val, section, option)
+}
+
+func parseString(val, section, option string) (string, error) {
+	if val == "" {
+		return "", &OptionError{section, option, msgEmpty}
+	}
+	return val, nil
+}
+
+func parseInt64(val, section, option string) (int64, error) {
+	if val == "" {
+		return 0, &OptionError{section, option, msgEmpty}
+	}
+	i, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return 0, &OptionError{section, option, msgNotInt + ", got " + val}
+	}
+	return i, nil
+}
+
+func parseBool(val, section, option string) (bool, error) {
+	switch strings.ToLower(val) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "":
+		return false, &OptionError{section, option, msgEmpty}
+	}
+	return false, &OptionError{section, option, msgNotBool + ", got " + val}
+}
+
+func parseJSON(val, section, option string) ([]byte, error) {
+	if val == "" {
+		return nil, &OptionError{section, option, msgEmpty}
+	}
+	if !ptjson.IsValidJSON([]byte(val)) {
+		return nil, &OptionError{section, option, msgNotJSON + ", got " + val}
+	}
+	return []byte(val), nil
+}
+
+// Sections 所有配置段
+func Sections(configFile string) []string {
+	return getSetting(configFile).Sections()
+}
+
+// getSetting 读取并缓存配置文件，读取失败时退出
 func getSetting(configFile string) *config.Config {
+	setting, err := loadSetting(configFile)
+	if err != nil {
+		log.Fatal(err, " Existing...")
+	}
+	return setting
+}
+
+// loadSetting 读取并缓存配置文件
+func loadSetting(configFile string) (*config.Config, error) {
 	settingMutex.Lock()
 	defer settingMutex.Unlock()
 	if setting, ok := settingMap[configFile]; ok && setting != nil {
-		return setting
+		return setting, nil
 	}
-	if setting, err := config.ReadDefault(configFile); err == nil {
-		settingMap[configFile] = setting
-		return setting
+	setting, err := readSetting(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read config file %s: %w", configFile, err)
 	}
-	log.Fatal("cannot find config file: ", configFile, " Existing...")
-	return nil
+	settingMap[configFile] = setting
+	return setting, nil
 }
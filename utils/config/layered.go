@@ -0,0 +1,241 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/robfig/config"
+)
+
+// 分层配置：
+//
+//	[include]
+//	files=base.cfg,routes/*.cfg     先读取include的文件（相对当前文件，支持通配符），当前文件覆盖它们
+//
+//	[gateway@prod]                  profile为prod时覆盖[gateway]中的同名配置
+//	debug=false
+//
+//	config.prod.cfg                 profile为prod时，存在则覆盖在config.cfg之上
+//
+//	url=amqp://%(user)s@${mq.host}/ 引用其他段的配置，%(option)s为本段或DEFAULT中的配置，同robfig/config
+//	dir=${HOME}/data                不含.的${NAME}为环境变量，由robfig/config展开，未设置时为空
+//
+// ${section.option}按-set、环境变量、配置文件的优先级取值，与读取配置项相同；段不存在时报错。
+// -set和环境变量的值原样使用，不再解析引用
+const (
+	includeSection = "include"
+	maxIncludes    = 32
+)
+
+var (
+	profileMutex sync.RWMutex
+	profile      string
+
+	settingFilesMutex sync.Mutex
+	settingFiles      = map[string][]string{} // 配置文件 -> 读取的全部文件，用于Watch
+
+	refRegExp = regexp.MustCompile(`\$\{([^}]+)\.([a-zA-Z0-9_\-]+)\}`) // ${section.option}
+)
+
+// SetProfile 设置profile，如prod，之后读取的配置生效
+func SetProfile(p string) {
+	profileMutex.Lock()
+	defer profileMutex.Unlock()
+	profile = p
+}
+
+// Profile 当前profile
+func Profile() string {
+	profileMutex.RLock()
+	defer profileMutex.RUnlock()
+	return profile
+}
+
+// readSetting 读取配置文件，处理include、profile和${section.option}引用
+func readSetting(configFile string) (*config.Config, error) {
+	var files []string
+	setting, err := readIncludes(configFile, &files, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	p := Profile()
+	if p != "" {
+		ext := filepath.Ext(configFile)
+		overlay := strings.TrimSuffix(configFile, ext) + "." + p + ext
+		if _, err := os.Stat(overlay); err == nil {
+			overlaySetting, err := readIncludes(overlay, &files, 0)
+			if err != nil {
+				return nil, err
+			}
+			merge(setting, overlaySetting)
+		} else {
+			// 不存在也监控，创建后重新加载
+			files = append(files, overlay)
+		}
+	}
+
+	for _, section := range setting.Sections() {
+		i := strings.LastIndex(section, "@")
+		if i <= 0 {
+			continue
+		}
+		if section[i+1:] == p {
+			options, _ := setting.SectionOptions(section)
+			for _, option := range options {
+				val, _ := setting.RawString(section, option)
+				setting.AddOption(section[:i], option, val)
+			}
+		}
+		setting.RemoveSection(section)
+	}
+
+	if err := resolveRefs(setting); err != nil {
+		return nil, fmt.Errorf("%s: %w", configFile, err)
+	}
+
+	settingFilesMutex.Lock()
+	settingFiles[configFile] = files
+	settingFilesMutex.Unlock()
+	return setting, nil
+}
+
+func readIncludes(file string, files *[]string, depth int) (*config.Config, error) {
+	if depth > maxIncludes {
+		return nil, fmt.Errorf("include too deep (cycle?): %s", file)
+	}
+	own, err := config.ReadDefault(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	*files = append(*files, file)
+
+	setting := config.NewDefault()
+	if raw, err := own.RawString(includeSection, "files"); err == nil && own.HasSection(includeSection) {
+		for _, pattern := range strings.Split(raw, ",") {
+			if pattern = strings.TrimSpace(pattern); pattern == "" {
+				continue
+			}
+			if !filepath.IsAbs(pattern) {
+				pattern = filepath.Join(filepath.Dir(file), pattern)
+			}
+			matches, err := filepath.Glob(pattern)
+			if err != nil {
+				return nil, err
+			}
+			if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+				return nil, fmt.Errorf("%s: include %s not found", file, pattern)
+			}
+			for _, match := range matches {
+				included, err := readIncludes(match, files, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				merge(setting, included)
+			}
+		}
+	}
+	own.RemoveSection(includeSection)
+	merge(setting, own)
+	return setting, nil
+}
+
+// merge 按顺序把source合并到target，同名配置source优先
+func merge(target, source *config.Config) {
+	for _, section := range source.Sections() {
+		target.AddSection(section)
+		options, _ := source.SectionOptions(section)
+		sort.Strings(options)
+		for _, option := range options {
+			val, _ := source.RawString(section, option)
+			target.AddOption(section, option, val)
+		}
+	}
+}
+
+// resolveRefs 替换${section.option}
+func resolveRefs(setting *config.Config) error {
+	for _, section := range setting.Sections() {
+		options, _ := setting.SectionOptions(section)
+		for _, option := range options {
+			val, _ := setting.RawString(section, option)
+			resolved, err := resolveValue(setting, val, 0)
+			if err != nil {
+				return fmt.Errorf("[%s] %s: %w", section, option, err)
+			}
+			if resolved != val {
+				setting.AddOption(section, option, resolved)
+			}
+		}
+	}
+	return nil
+}
+
+func resolveValue(setting *config.Config, val string, depth int) (string, error) {
+	if depth > maxIncludes {
+		return "", fmt.Errorf("reference cycle in %s", val)
+	}
+	var refErr error
+	resolved := refRegExp.ReplaceAllStringFunc(val, func(ref string) string {
+		m := refRegExp.FindStringSubmatch(ref)
+		if refVal, ok := lookupOverride(m[1], m[2]); ok {
+			return refVal
+		}
+		if !setting.HasSection(m[1]) {
+			refErr = fmt.Errorf("reference %s: section %s not found", ref, m[1])
+			return ref
+		}
+		// 被引用的值可能还没有替换，用原始值递归解析
+		refVal, err := setting.RawString(m[1], m[2])
+		if err != nil {
+			refErr = fmt.Errorf("reference %s: %w", ref, err)
+			return ref
+		}
+		if refVal, err = resolveValue(setting, refVal, depth+1); err != nil {
+			refErr = err
+		}
+		return refVal
+	})
+	return resolved, refErr
+}
+
+// Dump 输出合并include、profile、环境变量和命令行覆盖之后的完整配置，密钥和URL中的密码会隐藏
+func Dump(configFile string, w io.Writer) error {
+	setting, err := readSetting(configFile)
+	if err != nil {
+		return err
+	}
+	if p := Profile(); p != "" {
+		fmt.Fprintf(w, "# profile: %s\n", p)
+	}
+	for _, section := range setting.Sections() {
+		options, _ := setting.SectionOptions(section)
+		if len(options) == 0 {
+			continue
+		}
+		sort.Strings(options)
+		fmt.Fprintf(w, "\n[%s]\n", section)
+		for _, option := range options {
+			raw := lookupRaw(setting, section, option)
+			fmt.Fprintf(w, "%s=%s\n", option, maskValue(option, raw, lookup(setting, section, option)))
+		}
+	}
+	return nil
+}
+
+// sourceFiles 配置文件读取的全部文件，包括include和profile覆盖文件
+func sourceFiles(configFile string) []string {
+	settingFilesMutex.Lock()
+	defer settingFilesMutex.Unlock()
+	files := settingFiles[configFile]
+	if len(files) == 0 {
+		return []string{configFile}
+	}
+	return files
+}
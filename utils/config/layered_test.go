@@ -0,0 +1,208 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFiles 在同一个临时目录写入多个文件，返回目录
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestIncludes(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"config.cfg":      "[include]\nfiles=base.cfg,routes/*.cfg\n\n[gateway]\nlisten=:9001\n",
+		"base.cfg":        "[gateway]\nlisten=:9000\ntimeout=20\n",
+		"routes/a.cfg":    "[route:a]\nauth=none\n",
+		"routes/b.cfg":    "[route:b]\nauth=required\n",
+		"routes/skip.txt": "[route:c]\n",
+	})
+	setting, err := readSetting(filepath.Join(dir, "config.cfg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 当前文件覆盖include的文件
+	if got, _ := setting.String("gateway", "listen"); got != ":9001" {
+		t.Fatalf("listen = %q", got)
+	}
+	if got, _ := setting.String("gateway", "timeout"); got != "20" {
+		t.Fatalf("timeout = %q", got)
+	}
+	if got, _ := setting.String("route:b", "auth"); got != "required" {
+		t.Fatalf("route:b auth = %q", got)
+	}
+	if setting.HasSection("route:c") || setting.HasSection(includeSection) {
+		t.Fatalf("sections = %v", setting.Sections())
+	}
+	if files := sourceFiles(filepath.Join(dir, "config.cfg")); len(files) != 4 {
+		t.Fatalf("sourceFiles() = %v", files)
+	}
+}
+
+func TestIncludeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{"cycle", map[string]string{
+			"config.cfg": "[include]\nfiles=a.cfg\n",
+			"a.cfg":      "[include]\nfiles=config.cfg\n",
+		}, "cycle"},
+		{"self", map[string]string{"config.cfg": "[include]\nfiles=config.cfg\n"}, "cycle"},
+		{"missing", map[string]string{"config.cfg": "[include]\nfiles=missing.cfg\n"}, "not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, tt.files)
+			_, err := readSetting(filepath.Join(dir, "config.cfg"))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("readSetting() error = %v, want %s", err, tt.want)
+			}
+		})
+	}
+	// 通配符没有匹配时忽略
+	dir := writeFiles(t, map[string]string{"config.cfg": "[include]\nfiles=routes/*.cfg\n\n[gateway]\nlisten=:9000\n"})
+	if _, err := readSetting(filepath.Join(dir, "config.cfg")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	defer SetProfile("")
+	dir := writeFiles(t, map[string]string{
+		"config.cfg":      "[gateway]\nlisten=:9000\ndebug=true\ntimeout=20\n\n[gateway@prod]\ndebug=false\n\n[gateway@test]\ntimeout=1\n",
+		"config.prod.cfg": "[gateway]\nlisten=:80\n",
+	})
+	file := filepath.Join(dir, "config.cfg")
+
+	tests := []struct {
+		profile, listen, debug, timeout string
+	}{
+		{"", ":9000", "true", "20"},
+		{"prod", ":80", "false", "20"},
+		{"test", ":9000", "true", "1"},
+	}
+	for _, tt := range tests {
+		SetProfile(tt.profile)
+		setting, err := readSetting(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		listen, _ := setting.String("gateway", "listen")
+		debug, _ := setting.String("gateway", "debug")
+		timeout, _ := setting.String("gateway", "timeout")
+		if listen != tt.listen || debug != tt.debug || timeout != tt.timeout {
+			t.Errorf("profile %q: listen=%s debug=%s timeout=%s", tt.profile, listen, debug, timeout)
+		}
+		for _, section := range setting.Sections() {
+			if strings.Contains(section, "@") {
+				t.Errorf("profile %q: section %s not removed", tt.profile, section)
+			}
+		}
+	}
+	// 不存在的覆盖文件也监控
+	SetProfile("test")
+	readSetting(file)
+	if files := sourceFiles(file); len(files) != 2 || files[1] != filepath.Join(dir, "config.test.cfg") {
+		t.Fatalf("sourceFiles() = %v", files)
+	}
+}
+
+func TestReferences(t *testing.T) {
+	defer resetOverrides()
+	t.Setenv("PT_TEST_HOME", "/home/pt")
+	cfg := `[mq]
+host=127.0.0.1:5672
+user=admin
+
+[gateway]
+listen=:9000
+url=amqp://%(name)s@${mq.host}/
+name=gw
+dir=${PT_TEST_HOME}/data
+self=${gateway.listen}
+nested=${gateway.self}
+`
+	file := writeFile(t, "config.cfg", cfg)
+	setting, err := readSetting(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for option, want := range map[string]string{
+		"url":    "amqp://gw@127.0.0.1:5672/",
+		"dir":    "/home/pt/data",
+		"self":   ":9000",
+		"nested": ":9000",
+	} {
+		if got, _ := setting.String("gateway", option); got != want {
+			t.Errorf("%s = %q, want %q", option, got, want)
+		}
+	}
+
+	// 引用按-set、环境变量、配置文件的优先级取值
+	t.Setenv("GATEWAY_LISTEN", ":9001")
+	Set("mq", "host", "mq.internal:5672")
+	setting, err = readSetting(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := setting.String("gateway", "self"); got != ":9001" {
+		t.Errorf("self with env = %q", got)
+	}
+	if got, _ := setting.String("gateway", "nested"); got != ":9001" {
+		t.Errorf("nested with env = %q", got)
+	}
+	if got, _ := setting.String("gateway", "url"); got != "amqp://gw@mq.internal:5672/" {
+		t.Errorf("url with -set = %q", got)
+	}
+}
+
+func TestReferenceErrors(t *testing.T) {
+	tests := []struct {
+		name, cfg, want string
+	}{
+		{"missing section", "[gateway]\nurl=${mq.host}\n", "section mq not found"},
+		{"missing option", "[mq]\nuser=a\n\n[gateway]\nurl=${mq.host}\n", "${mq.host}"},
+		{"cycle", "[a]\nx=${b.y}\n\n[b]\ny=${a.x}\n", "cycle"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readSetting(writeFile(t, "config.cfg", tt.cfg))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("readSetting() error = %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDumpMasksSecrets(t *testing.T) {
+	t.Setenv("PT_TEST_DUMP_KEY", "k")
+	file := writeFile(t, "config.cfg", "[gateway]\nsignKey=env:PT_TEST_DUMP_KEY\nlisten=:9000\n\n[mysql]\nurl=admin:123456@tcp(127.0.0.1:3306)/db1\n")
+	var out strings.Builder
+	if err := Dump(file, &out); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"signKey=******", "listen=:9000", "url=admin:******@tcp(127.0.0.1:3306)/db1"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Dump() missing %q:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "123456") {
+		t.Errorf("Dump() leaks password:\n%s", out.String())
+	}
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/robfig/config"
+)
+
+// 配置优先级：命令行（Set、Overrides）> 环境变量（SECTION_OPTION）> 配置文件
+
+var (
+	overrideMutex sync.RWMutex
+	overrides     = map[string]string{} // section.option -> value
+	envPrefix     string
+)
+
+// Set 用命令行参数覆盖配置，对所有配置文件生效
+func Set(section, option, value string) {
+	overrideMutex.Lock()
+	defer overrideMutex.Unlock()
+	overrides[section+"."+option] = value
+}
+
+// SetEnvPrefix 环境变量前缀，如设为PT时[gateway] listen对应PT_GATEWAY_LISTEN
+func SetEnvPrefix(prefix string) {
+	overrideMutex.Lock()
+	defer overrideMutex.Unlock()
+	envPrefix = prefix
+}
+
+// EnvName 配置项对应的环境变量名，大写，字母数字以外的字符换成_，如[route:examples_1.0] auth为ROUTE_EXAMPLES_1_0_AUTH
+func EnvName(section, option string) string {
+	overrideMutex.RLock()
+	name := section + "_" + option
+	if envPrefix != "" {
+		name = envPrefix + "_" + name
+	}
+	overrideMutex.RUnlock()
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// Overrides 实现flag.Value，解析section.option=value，可以重复使用
+//
+//	flag.Var(config.Overrides{}, "set", "覆盖配置，如 -set gateway.listen=:9001")
+type Overrides struct{}
+
+func (Overrides) String() string {
+	return ""
+}
+
+// Set section可以包含.，以最后一个.分隔option
+func (Overrides) Set(s string) error {
+	eq := strings.Index(s, "=")
+	if eq < 0 {
+		return errors.New("expect section.option=value")
+	}
+	key := s[:eq]
+	dot := strings.LastIndex(key, ".")
+	if dot <= 0 || dot == len(key)-1 {
+		return errors.New("expect section.option=value")
+	}
+	Set(key[:dot], key[dot+1:], s[eq+1:])
+	return nil
+}
+
+// lookupRaw 按优先级读取配置项，都没有时返回空
+func lookupRaw(setting *config.Config, section, option string) string {
+	if val, ok := lookupOverride(section, option); ok {
+		return val
+	}
+	val, _ := setting.String(section, option)
+	return val
+}
+
+// lookupOverride 命令行或环境变量的覆盖值，空的环境变量不算
+func lookupOverride(section, option string) (string, bool) {
+	overrideMutex.RLock()
+	val, ok := overrides[section+"."+option]
+	overrideMutex.RUnlock()
+	if ok {
+		return val, true
+	}
+	if val, ok := os.LookupEnv(EnvName(section, option)); ok && val != "" {
+		return val, true
+	}
+	return "", false
+}
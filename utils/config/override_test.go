@@ -0,0 +1,90 @@
+package config
+
+import (
+	"testing"
+)
+
+// resetOverrides 清空Set和SetEnvPrefix，测试结束时调用
+func resetOverrides() {
+	overrideMutex.Lock()
+	defer overrideMutex.Unlock()
+	overrides = map[string]string{}
+	envPrefix = ""
+}
+
+func TestPrecedence(t *testing.T) {
+	defer resetOverrides()
+	file := writeFile(t, "config.cfg", "[gateway]\nlisten=:9000\ntimeout=20\ndebug=true\n")
+
+	if got := String(file, "gateway", "listen"); got != ":9000" {
+		t.Fatalf("file listen = %q", got)
+	}
+	t.Setenv("GATEWAY_LISTEN", ":9001")
+	t.Setenv("GATEWAY_SCHEMADIR", "/schemas") // 文件中没有的配置
+	if got := String(file, "gateway", "listen"); got != ":9001" {
+		t.Fatalf("env listen = %q", got)
+	}
+	if got := StringDefault(file, "gateway", "schemaDir", ""); got != "/schemas" {
+		t.Fatalf("env schemaDir = %q", got)
+	}
+	// 空的环境变量不覆盖
+	t.Setenv("GATEWAY_TIMEOUT", "")
+	if got := Int64(file, "gateway", "timeout"); got != 20 {
+		t.Fatalf("empty env timeout = %d", got)
+	}
+	Set("gateway", "listen", ":9002")
+	if got := String(file, "gateway", "listen"); got != ":9002" {
+		t.Fatalf("-set listen = %q", got)
+	}
+
+	SetEnvPrefix("PT")
+	t.Setenv("PT_GATEWAY_DEBUG", "false")
+	if got := Bool(file, "gateway", "debug"); got {
+		t.Fatal("PT_GATEWAY_DEBUG not applied")
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	defer resetOverrides()
+	tests := []struct {
+		prefix, section, option, want string
+	}{
+		{"", "gateway", "listen", "GATEWAY_LISTEN"},
+		{"", "route:examples_1.0", "auth", "ROUTE_EXAMPLES_1_0_AUTH"},
+		{"", "backend:orders", "healthPath", "BACKEND_ORDERS_HEALTHPATH"},
+		{"pt", "mq", "url", "PT_MQ_URL"},
+	}
+	for _, tt := range tests {
+		SetEnvPrefix(tt.prefix)
+		if got := EnvName(tt.section, tt.option); got != tt.want {
+			t.Errorf("EnvName(%q, %q) = %q, want %q", tt.section, tt.option, got, tt.want)
+		}
+	}
+}
+
+func TestOverridesSet(t *testing.T) {
+	defer resetOverrides()
+	tests := []struct {
+		in, key, val string
+		ok           bool
+	}{
+		{"gateway.listen=:9001", "gateway.listen", ":9001", true},
+		{"route:examples_1.0.auth=required", "route:examples_1.0.auth", "required", true},
+		{"mq.url=amqp://a:b@h/?x=1", "mq.url", "amqp://a:b@h/?x=1", true},
+		{"gateway.debug=", "gateway.debug", "", true},
+		{"gateway.listen", "", "", false},
+		{"listen=:9001", "", "", false},
+		{"gateway.=x", "", "", false},
+		{".listen=x", "", "", false},
+	}
+	for _, tt := range tests {
+		err := Overrides{}.Set(tt.in)
+		if (err == nil) != tt.ok {
+			t.Errorf("Set(%q) error = %v", tt.in, err)
+			continue
+		}
+		if tt.ok && overrides[tt.key] != tt.val {
+			t.Errorf("Set(%q): overrides[%q] = %q, want %q", tt.in, tt.key, overrides[tt.key], tt.val)
+		}
+	}
+}
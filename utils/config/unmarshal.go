@@ -0,0 +1,182 @@
+package config
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/haierspi/pt-gateway/utils/ptjson"
+)
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	urlType             = reflect.TypeOf(url.URL{})
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Unmarshal 把配置段绑定到结构体，v为结构体指针，返回全部字段的问题
+//
+// tag为`config:"name,required" default:"value"`，不写name时为字段名首字母小写，`config:"-"`跳过。支持：
+//
+//	string、bool、int*、uint*、float*
+//	time.Duration   如30s，纯数字为秒
+//	[]T             逗号分隔
+//	*url.URL、url.URL
+//	map、struct      json object，与JSON一样校验
+//	encoding.TextUnmarshaler
+func Unmarshal(configFile, section string, v interface{}) error {
+	setting, err := loadSetting(configFile)
+	if err != nil {
+		return err
+	}
+	c := newCheckerWithSetting(setting)
+	c.Unmarshal(section, v)
+	return c.Err()
+}
+
+// Unmarshal 见Unmarshal，问题记录到Checker
+func (c *Checker) Unmarshal(section string, v interface{}) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		c.Add(errors.New("config: Unmarshal expects a pointer to struct"))
+		return
+	}
+	rv = rv.Elem()
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if field.PkgPath != "" {
+			continue // 未导出
+		}
+		name, required := optionName(field)
+		if name == "-" {
+			continue
+		}
+		val, resolved := c.value(section, name)
+		if !resolved {
+			continue // 密钥引用无法解析，已记录
+		}
+		ok := val != ""
+		if !ok {
+			val, ok = field.Tag.Lookup("default")
+		}
+		if !ok || val == "" {
+			if required {
+				c.Add(&OptionError{section, name, msgEmpty})
+			}
+			continue
+		}
+		if err := setValue(rv.Field(i), val); err != nil {
+			c.Add(&OptionError{section, name, err.Error()})
+		}
+	}
+}
+
+func optionName(field reflect.StructField) (name string, required bool) {
+	tag := strings.Split(field.Tag.Get("config"), ",")
+	name = tag[0]
+	for _, opt := range tag[1:] {
+		if opt == "required" {
+			required = true
+		}
+	}
+	if name == "" {
+		r, size := utf8.DecodeRuneInString(field.Name)
+		name = string(unicode.ToLower(r)) + field.Name[size:]
+	}
+	return name, required
+}
+
+func setValue(v reflect.Value, val string) error {
+	if v.Kind() == reflect.Ptr {
+		elem := reflect.New(v.Type().Elem())
+		if err := setValue(elem.Elem(), val); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(val))
+	}
+
+	switch v.Type() {
+	case durationType:
+		if seconds, err := strconv.ParseInt(val, 10, 64); err == nil {
+			v.SetInt(int64(time.Duration(seconds) * time.Second))
+			return nil
+		}
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return fmt.Errorf("expect a duration, got %s", val)
+		}
+		v.SetInt(int64(d))
+		return nil
+	case urlType:
+		u, err := url.Parse(val)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(*u))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(val)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return errors.New(msgNotBool + ", got " + val)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(val, 10, v.Type().Bits())
+		if err != nil {
+			return errors.New(msgNotInt + ", got " + val)
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(val, 10, v.Type().Bits())
+		if err != nil {
+			return errors.New("expect an unsigned int value, got " + val)
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(val, v.Type().Bits())
+		if err != nil {
+			return errors.New("expect a float value, got " + val)
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(val, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		slice := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setValue(slice.Index(i), item); err != nil {
+				return fmt.Errorf("item %d: %w", i, err)
+			}
+		}
+		v.Set(slice)
+	case reflect.Map, reflect.Struct:
+		data, err := parseJSON(val, "", "")
+		if err != nil {
+			return errors.New(msgNotJSON + ", got " + val)
+		}
+		return ptjson.Unmarshal(data, v.Addr().Interface())
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"net"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type allKinds struct {
+	Name       string            `config:"name,required"`
+	Debug      bool              `config:"debug"`
+	Port       int               `config:"port" default:"9000"`
+	Small      int8              `config:"small"`
+	Count      uint32            `config:"count"`
+	Rate       float64           `config:"rate" default:"0.5"`
+	Timeout    time.Duration     `config:"timeout" default:"10s"`
+	Seconds    time.Duration     `config:"seconds"`
+	Hosts      []string          `config:"hosts"`
+	Ports      []int             `config:"ports"`
+	Intervals  []time.Duration   `config:"intervals"`
+	Endpoint   *url.URL          `config:"endpoint"`
+	Base       url.URL           `config:"base"`
+	Labels     map[string]string `config:"labels"`
+	Limits     struct{ Max int } `config:"limits"`
+	IP         net.IP            `config:"ip"` // encoding.TextUnmarshaler
+	Secret     string            `config:"secret"`
+	Implicit   string            // 名字为implicit
+	Skipped    string            `config:"-"`
+	unexported string
+}
+
+func TestUnmarshal(t *testing.T) {
+	t.Setenv("PT_TEST_UNMARSHAL_SECRET", "s3cret")
+	file := writeFile(t, "config.cfg", `[app]
+name=pt
+debug=true
+small=-8
+count=42
+seconds=30
+hosts=a, b,,c
+ports=80,443
+intervals=1s,2
+endpoint=https://example.com/api?x=1
+base=http://127.0.0.1:8080
+labels={"env":"prod"}
+limits={"Max":3}
+ip=10.0.0.1
+secret=env:PT_TEST_UNMARSHAL_SECRET
+implicit=yes
+skipped=no
+unexported=no
+`)
+	var got allKinds
+	if err := Unmarshal(file, "app", &got); err != nil {
+		t.Fatal(err)
+	}
+	endpoint, _ := url.Parse("https://example.com/api?x=1")
+	base, _ := url.Parse("http://127.0.0.1:8080")
+	want := allKinds{
+		Name:      "pt",
+		Debug:     true,
+		Port:      9000,
+		Small:     -8,
+		Count:     42,
+		Rate:      0.5,
+		Timeout:   10 * time.Second,
+		Seconds:   30 * time.Second,
+		Hosts:     []string{"a", "b", "c"},
+		Ports:     []int{80, 443},
+		Intervals: []time.Duration{time.Second, 2 * time.Second},
+		Endpoint:  endpoint,
+		Base:      *base,
+		Labels:    map[string]string{"env": "prod"},
+		Limits:    struct{ Max int }{3},
+		IP:        net.ParseIP("10.0.0.1"),
+		Secret:    "s3cret",
+		Implicit:  "yes",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Unmarshal() =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+// 全部字段的问题一起返回
+func TestUnmarshalErrors(t *testing.T) {
+	file := writeFile(t, "config.cfg", `[app]
+debug=yes
+port=http
+small=200
+count=-1
+rate=fast
+timeout=soon
+ports=80,x
+endpoint=http://[::1
+labels=[1]
+ip=999.0.0.1
+`)
+	var got allKinds
+	err := Unmarshal(file, "app", &got)
+	if err == nil {
+		t.Fatal("Unmarshal() error = nil")
+	}
+	for _, want := range []string{
+		"[app] name: " + msgEmpty,
+		"[app] debug: " + msgNotBool,
+		"[app] port: " + msgNotInt,
+		"[app] small: " + msgNotInt,
+		"[app] count: expect an unsigned int",
+		"[app] rate: expect a float",
+		"[app] timeout: expect a duration",
+		"[app] ports: item 1: " + msgNotInt,
+		"[app] endpoint:",
+		"[app] labels: " + msgNotJSON,
+		"[app] ip:",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error missing %q:\n%v", want, err)
+		}
+	}
+
+	if err := Unmarshal(file, "app", got); err == nil || !strings.Contains(err.Error(), "pointer to struct") {
+		t.Fatalf("Unmarshal(non-pointer) error = %v", err)
+	}
+}
+
+// 没有配置段时全部使用默认值
+func TestUnmarshalDefaults(t *testing.T) {
+	file := writeFile(t, "config.cfg", "[other]\na=1\n")
+	var got struct {
+		Port    int           `config:"port" default:"9000"`
+		Timeout time.Duration `config:"timeout" default:"1m"`
+		Hosts   []string      `config:"hosts" default:"a,b"`
+		Empty   string        `config:"empty"`
+	}
+	if err := Unmarshal(file, "app", &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Port != 9000 || got.Timeout != time.Minute || !reflect.DeepEqual(got.Hosts, []string{"a", "b"}) || got.Empty != "" {
+		t.Fatalf("Unmarshal() = %+v", got)
+	}
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	watchMutex  sync.Mutex
+	subscribers = map[string][]func(){}
+	validators  = map[string][]func(c *Checker) error{}
+	watching    = map[string]bool{}
+	sighupOnce  sync.Once
+)
+
+// Subscribe 配置文件重新加载后调用fn
+func Subscribe(configFile string, fn func()) {
+	watchMutex.Lock()
+	defer watchMutex.Unlock()
+	subscribers[configFile] = append(subscribers[configFile], fn)
+}
+
+// OnValidate 重新加载时先用新配置调用validate，返回错误则放弃本次加载，继续使用原配置
+func OnValidate(configFile string, validate func(c *Checker) error) {
+	watchMutex.Lock()
+	defer watchMutex.Unlock()
+	validators[configFile] = append(validators[configFile], validate)
+}
+
+// Reload 重新读取配置文件，校验通过后替换并通知订阅者
+func Reload(configFile string) error {
+	// 密钥文件可能已轮换
+	clearSecrets()
+	setting, err := readSetting(configFile)
+	if err != nil {
+		return err
+	}
+	watchMutex.Lock()
+	fileValidators := validators[configFile]
+	fileSubscribers := subscribers[configFile]
+	watchMutex.Unlock()
+	for _, validate := range fileValidators {
+		if err := validate(newCheckerWithSetting(setting)); err != nil {
+			return err
+		}
+	}
+
+	settingMutex.Lock()
+	settingMap[configFile] = setting
+	settingMutex.Unlock()
+	for _, fn := range fileSubscribers {
+		fn()
+	}
+	return nil
+}
+
+// Watch 每interval检查一次文件（包括include和profile覆盖的文件）修改时间，修改后重新加载；
+// 收到SIGHUP时重新加载所有被Watch的文件
+func Watch(configFile string, interval time.Duration) {
+	watchMutex.Lock()
+	if watching[configFile] {
+		watchMutex.Unlock()
+		return
+	}
+	watching[configFile] = true
+	watchMutex.Unlock()
+
+	sighupOnce.Do(func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGHUP)
+		go func() {
+			for range signals {
+				watchMutex.Lock()
+				files := make([]string, 0, len(watching))
+				for file := range watching {
+					files = append(files, file)
+				}
+				watchMutex.Unlock()
+				for _, file := range files {
+					reloadAndLog(file)
+				}
+			}
+		}()
+	})
+
+	go func() {
+		modTime := filesModTime(sourceFiles(configFile))
+		for range time.Tick(interval) {
+			if t := filesModTime(sourceFiles(configFile)); t != modTime {
+				modTime = t
+				reloadAndLog(configFile)
+			}
+		}
+	}()
+}
+
+func reloadAndLog(configFile string) {
+	if err := Reload(configFile); err != nil {
+		log.Println("reload config", configFile, "failed, keep the old one:", err)
+	} else {
+		log.Println("reload config", configFile)
+	}
+}
+
+// filesModTime 全部文件的修改时间，任何一个修改、新增或删除都会不同
+func filesModTime(files []string) string {
+	var modTimes []string
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			modTimes = append(modTimes, file+"@"+info.ModTime().String())
+		}
+	}
+	return strings.Join(modTimes, ",")
+}
@@ -0,0 +1,91 @@
+package jsondiff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+)
+
+// maxValueLen 差异中值的最大长度
+const maxValueLen = 200
+
+var indexPattern = regexp.MustCompile(`\[\d+\]`)
+
+// Diff 比较两个json，返回不同的字段，如Data.Items[0].Price: 1 -> 2
+//
+// ignore为不比较的字段，数组下标省略，如Data.Items.UpdatedAt
+func Diff(a, b []byte, ignore map[string]bool) ([]string, error) {
+	var av, bv interface{}
+	if err := decode(a, &av); err != nil {
+		return nil, err
+	}
+	if err := decode(b, &bv); err != nil {
+		return nil, err
+	}
+	var diffs []string
+	diffValue("", av, bv, ignore, &diffs)
+	return diffs, nil
+}
+
+func diffValue(path string, a, b interface{}, ignore map[string]bool, diffs *[]string) {
+	if path != "" && ignore[indexPattern.ReplaceAllString(path, "")] {
+		return
+	}
+	switch av := a.(type) {
+	case map[string]interface{}:
+		if bv, ok := b.(map[string]interface{}); ok {
+			keys := make([]string, 0, len(av)+len(bv))
+			for k := range av {
+				keys = append(keys, k)
+			}
+			for k := range bv {
+				if _, ok := av[k]; !ok {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				child := k
+				if path != "" {
+					child = path + "." + k
+				}
+				diffValue(child, av[k], bv[k], ignore, diffs)
+			}
+			return
+		}
+	case []interface{}:
+		if bv, ok := b.([]interface{}); ok && len(av) == len(bv) {
+			for i := range av {
+				diffValue(fmt.Sprintf("%s[%d]", path, i), av[i], bv[i], ignore, diffs)
+			}
+			return
+		}
+	}
+	if !reflect.DeepEqual(a, b) {
+		if path == "" {
+			path = "."
+		}
+		*diffs = append(*diffs, fmt.Sprintf("%s: %s -> %s", path, valueString(a), valueString(b)))
+	}
+}
+
+// decode 数字保留原样，避免大整数精度问题
+func decode(data []byte, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	return d.Decode(v)
+}
+
+func valueString(v interface{}) string {
+	if v == nil {
+		return "(none)"
+	}
+	b, _ := json.Marshal(v)
+	if len(b) > maxValueLen {
+		return string(b[:maxValueLen]) + "..."
+	}
+	return string(b)
+}
@@ -0,0 +1,367 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/haierspi/pt-gateway/utils/ptjson"
+)
+
+// Schema JSON Schema的常用子集：type、properties、required、additionalProperties、items、enum、
+// minimum、maximum、exclusiveMinimum、exclusiveMaximum、minLength、maxLength、pattern、format、minItems、maxItems
+type Schema struct {
+	Title       string      `json:"title,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Type        interface{} `json:"type,omitempty"` // 字符串或字符串数组
+	Default     interface{} `json:"default,omitempty"`
+	Example     interface{} `json:"example,omitempty"`
+
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+
+	Items    *Schema `json:"items,omitempty"`
+	MinItems *int    `json:"minItems,omitempty"`
+	MaxItems *int    `json:"maxItems,omitempty"`
+
+	Enum             []interface{} `json:"enum,omitempty"`
+	Minimum          *float64      `json:"minimum,omitempty"`
+	Maximum          *float64      `json:"maximum,omitempty"`
+	ExclusiveMinimum *float64      `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum *float64      `json:"exclusiveMaximum,omitempty"`
+	MinLength        *int          `json:"minLength,omitempty"`
+	MaxLength        *int          `json:"maxLength,omitempty"`
+	Pattern          string        `json:"pattern,omitempty"`
+	Format           string        `json:"format,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// FieldError 字段错误，Field如items[0].name，整个对象为空
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+// Load 读取并编译schema文件
+func Load(file string) (*Schema, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse 解析并编译schema，有不支持的关键字（如$ref、oneOf）时返回错误，避免schema不生效
+func Parse(data []byte) (*Schema, error) {
+	var raw interface{}
+	if err := ptjson.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	if err := checkKeywords(raw); err != nil {
+		return nil, err
+	}
+	var schema Schema
+	if err := ptjson.Unmarshal(data, &schema); err != nil {
+		return nil, err
+	}
+	if err := schema.compile(); err != nil {
+		return nil, err
+	}
+	return &schema, nil
+}
+
+// annotations 不影响校验的关键字
+var annotations = []string{"$schema", "$id", "$comment", "examples", "deprecated", "readOnly", "writeOnly"}
+
+// keywords 支持的关键字，取自Schema的json tag和annotations
+var keywords = func() map[string]bool {
+	keywords := map[string]bool{}
+	t := reflect.TypeOf(Schema{})
+	for i := 0; i < t.NumField(); i++ {
+		if name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]; name != "" {
+			keywords[name] = true
+		}
+	}
+	for _, name := range annotations {
+		keywords[name] = true
+	}
+	return keywords
+}()
+
+// checkKeywords 检查schema及properties、items中的关键字
+func checkKeywords(raw interface{}) error {
+	schema, ok := raw.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("expect a json object, got %v", raw)
+	}
+	for _, name := range sortedKeys(schema) {
+		if !keywords[name] {
+			return fmt.Errorf("unsupported keyword %q", name)
+		}
+	}
+	if properties, ok := schema["properties"].(map[string]interface{}); ok {
+		for _, name := range sortedKeys(properties) {
+			if err := checkKeywords(properties[name]); err != nil {
+				return fmt.Errorf("property %s: %w", name, err)
+			}
+		}
+	}
+	if items, ok := schema["items"]; ok {
+		if err := checkKeywords(items); err != nil {
+			return fmt.Errorf("items: %w", err)
+		}
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *Schema) compile() (err error) {
+	if s.Pattern != "" {
+		if s.pattern, err = regexp.Compile(s.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", s.Pattern, err)
+		}
+	}
+	for _, t := range s.types() {
+		switch t {
+		case "object", "array", "string", "number", "integer", "boolean", "null":
+		default:
+			return fmt.Errorf("invalid type %q", t)
+		}
+	}
+	for name, property := range s.Properties {
+		if property == nil {
+			return fmt.Errorf("property %s: empty schema", name)
+		}
+		if err = property.compile(); err != nil {
+			return fmt.Errorf("property %s: %w", name, err)
+		}
+	}
+	if s.Items != nil {
+		if err = s.Items.compile(); err != nil {
+			return fmt.Errorf("items: %w", err)
+		}
+	}
+	return nil
+}
+
+// types type字段，未指定时为空
+func (s *Schema) types() []string {
+	switch t := s.Type.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		types := make([]string, 0, len(t))
+		for _, v := range t {
+			if str, ok := v.(string); ok {
+				types = append(types, str)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+// Validate 校验json解码后的值，返回全部字段错误
+func (s *Schema) Validate(v interface{}) []FieldError {
+	var errs []FieldError
+	s.validate("", v, &errs)
+	return errs
+}
+
+func (s *Schema) validate(field string, v interface{}, errs *[]FieldError) {
+	fail := func(format string, args ...interface{}) {
+		*errs = append(*errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if types := s.types(); len(types) > 0 {
+		matched := false
+		for _, t := range types {
+			if typeOf(v, t) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("类型应为%v", s.Type)
+			return
+		}
+	}
+	if len(s.Enum) > 0 && !inEnum(v, s.Enum) {
+		fail("取值应为%v之一", s.Enum)
+	}
+
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := val[name]; !ok {
+				*errs = append(*errs, FieldError{Field: join(field, name), Message: "必填"})
+			}
+		}
+		names := make([]string, 0, len(val))
+		for name := range val {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if property, ok := s.Properties[name]; ok {
+				property.validate(join(field, name), val[name], errs)
+			} else if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				*errs = append(*errs, FieldError{Field: join(field, name), Message: "不允许的字段"})
+			}
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(val) < *s.MinItems {
+			fail("至少%d项", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(val) > *s.MaxItems {
+			fail("最多%d项", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range val {
+				s.Items.validate(field+"["+strconv.Itoa(i)+"]", item, errs)
+			}
+		}
+	case string:
+		length := len([]rune(val))
+		if s.MinLength != nil && length < *s.MinLength {
+			fail("长度至少为%d", *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			fail("长度最多为%d", *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(val) {
+			fail("格式错误，应匹配%s", s.Pattern)
+		}
+		if s.Format != "" && !validFormat(s.Format, val) {
+			fail("格式错误，应为%s", s.Format)
+		}
+	default:
+		if n, ok := toFloat(v); ok {
+			if s.Minimum != nil && n < *s.Minimum {
+				fail("不能小于%v", *s.Minimum)
+			}
+			if s.Maximum != nil && n > *s.Maximum {
+				fail("不能大于%v", *s.Maximum)
+			}
+			if s.ExclusiveMinimum != nil && n <= *s.ExclusiveMinimum {
+				fail("必须大于%v", *s.ExclusiveMinimum)
+			}
+			if s.ExclusiveMaximum != nil && n >= *s.ExclusiveMaximum {
+				fail("必须小于%v", *s.ExclusiveMaximum)
+			}
+		}
+	}
+}
+
+func join(field, name string) string {
+	if field == "" {
+		return name
+	}
+	return field + "." + name
+}
+
+func typeOf(v interface{}, t string) bool {
+	switch t {
+	case "object":
+		_, ok := v.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := v.([]interface{})
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "null":
+		return v == nil
+	case "number":
+		_, ok := toFloat(v)
+		return ok
+	case "integer":
+		n, ok := toFloat(v)
+		return ok && n == math.Trunc(n)
+	}
+	return false
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func inEnum(v interface{}, enum []interface{}) bool {
+	for _, e := range enum {
+		if reflect.DeepEqual(e, v) {
+			return true
+		}
+		if a, ok := toFloat(e); ok {
+			if b, ok := toFloat(v); ok && a == b {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func validFormat(format, v string) bool {
+	switch format {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, v)
+		return err == nil
+	case "date":
+		_, err := time.Parse("2006-01-02", v)
+		return err == nil
+	case "email":
+		_, err := mail.ParseAddress(v)
+		return err == nil
+	case "uri":
+		u, err := url.Parse(v)
+		return err == nil && u.Scheme != ""
+	case "ipv4":
+		ip := net.ParseIP(v)
+		return ip != nil && ip.To4() != nil
+	case "ipv6":
+		ip := net.ParseIP(v)
+		return ip != nil && ip.To4() == nil
+	case "uuid":
+		return uuidPattern.MatchString(v)
+	}
+	// 未知的format不校验
+	return true
+}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
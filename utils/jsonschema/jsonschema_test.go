@@ -0,0 +1,160 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRejectsUnsupportedKeywords(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		err    string
+	}{
+		{"ref", `{"$ref":"#/definitions/a"}`, `unsupported keyword "$ref"`},
+		{"oneOf", `{"type":"object","oneOf":[{"required":["a"]}]}`, `unsupported keyword "oneOf"`},
+		{"nested const", `{"type":"object","properties":{"a":{"const":1}}}`, `property a: unsupported keyword "const"`},
+		{"items", `{"type":"array","items":{"patternProperties":{}}}`, `items: unsupported keyword "patternProperties"`},
+		{"supported", `{"$schema":"https://json-schema.org/draft/2020-12/schema","type":"object","required":["a"],"properties":{"a":{"type":"string","minLength":1,"examples":["x"]}}}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.schema))
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("Parse() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Parse() error = %v, want %s", err, tt.err)
+			}
+		})
+	}
+}
+
+const orderSchema = `{
+	"type": "object",
+	"required": ["OrderID", "Items"],
+	"additionalProperties": false,
+	"properties": {
+		"OrderID": {"type": "string", "minLength": 4, "maxLength": 8, "pattern": "^O[0-9]+$"},
+		"Status": {"enum": ["paid", "shipped"]},
+		"Amount": {"type": "number", "minimum": 0, "maximum": 1000},
+		"Count": {"type": "integer", "exclusiveMinimum": 0, "exclusiveMaximum": 10},
+		"Email": {"type": "string", "format": "email"},
+		"Note": {"type": ["string", "null"]},
+		"Items": {
+			"type": "array",
+			"minItems": 1,
+			"maxItems": 2,
+			"items": {
+				"type": "object",
+				"required": ["SKU"],
+				"properties": {
+					"SKU": {"type": "string"},
+					"Tags": {"type": "array", "items": {"type": "string"}}
+				}
+			}
+		}
+	}
+}`
+
+func TestValidate(t *testing.T) {
+	schema, err := Parse([]byte(orderSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		data string
+		want []FieldError
+	}{
+		{"valid", `{"OrderID":"O123","Status":"paid","Amount":0,"Count":9,"Email":"a@example.com","Note":null,"Items":[{"SKU":"a","Tags":["x"]}]}`, nil},
+		{"not object", `[]`, []FieldError{{"", "类型应为object"}}},
+		{"required", `{}`, []FieldError{{"OrderID", "必填"}, {"Items", "必填"}}},
+		{"additional property", `{"OrderID":"O123","Items":[{"SKU":"a"}],"Extra":1}`, []FieldError{{"Extra", "不允许的字段"}}},
+		{"string type", `{"OrderID":123,"Items":[{"SKU":"a"}]}`, []FieldError{{"OrderID", "类型应为string"}}},
+		{"string length and pattern", `{"OrderID":"X1","Items":[{"SKU":"a"}]}`, []FieldError{
+			{"OrderID", "长度至少为4"},
+			{"OrderID", "格式错误，应匹配^O[0-9]+$"},
+		}},
+		{"max length counts runes", `{"OrderID":"O1234567","Items":[{"SKU":"a"}],"Note":"订单"}`, nil},
+		{"max length", `{"OrderID":"O12345678","Items":[{"SKU":"a"}]}`, []FieldError{{"OrderID", "长度最多为8"}}},
+		{"enum", `{"OrderID":"O123","Items":[{"SKU":"a"}],"Status":"lost"}`, []FieldError{{"Status", "取值应为[paid shipped]之一"}}},
+		{"minimum and maximum", `{"OrderID":"O123","Items":[{"SKU":"a"}],"Amount":-1}`, []FieldError{{"Amount", "不能小于0"}}},
+		{"maximum", `{"OrderID":"O123","Items":[{"SKU":"a"}],"Amount":1000.5}`, []FieldError{{"Amount", "不能大于1000"}}},
+		{"exclusive minimum", `{"OrderID":"O123","Items":[{"SKU":"a"}],"Count":0}`, []FieldError{{"Count", "必须大于0"}}},
+		{"exclusive maximum", `{"OrderID":"O123","Items":[{"SKU":"a"}],"Count":10}`, []FieldError{{"Count", "必须小于10"}}},
+		{"integer", `{"OrderID":"O123","Items":[{"SKU":"a"}],"Count":1.5}`, []FieldError{{"Count", "类型应为integer"}}},
+		{"format", `{"OrderID":"O123","Items":[{"SKU":"a"}],"Email":"not an email"}`, []FieldError{{"Email", "格式错误，应为email"}}},
+		{"type list", `{"OrderID":"O123","Items":[{"SKU":"a"}],"Note":1}`, []FieldError{{"Note", "类型应为[string null]"}}},
+		{"min items", `{"OrderID":"O123","Items":[]}`, []FieldError{{"Items", "至少1项"}}},
+		{"max items", `{"OrderID":"O123","Items":[{"SKU":"a"},{"SKU":"b"},{"SKU":"c"}]}`, []FieldError{{"Items", "最多2项"}}},
+		{"nested", `{"OrderID":"O123","Items":[{"SKU":"a"},{"Tags":["x",2]}]}`, []FieldError{
+			{"Items[1].SKU", "必填"},
+			{"Items[1].Tags[1]", "类型应为string"},
+		}},
+		{"all errors", `{"OrderID":1,"Items":"x","Amount":"1"}`, []FieldError{
+			{"Amount", "类型应为number"},
+			{"Items", "类型应为array"},
+			{"OrderID", "类型应为string"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var data interface{}
+			if err := json.Unmarshal([]byte(tt.data), &data); err != nil {
+				t.Fatal(err)
+			}
+			if got := schema.Validate(data); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Validate() =\n%v\nwant\n%v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateFormats(t *testing.T) {
+	tests := []struct {
+		format, valid, invalid string
+	}{
+		{"date-time", "2024-01-02T03:04:05Z", "2024-01-02 03:04:05"},
+		{"date", "2024-01-02", "2024-13-02"},
+		{"email", "a@example.com", "a"},
+		{"uri", "https://example.com/a", "/a"},
+		{"ipv4", "10.0.0.1", "::1"},
+		{"ipv6", "::1", "10.0.0.1"},
+		{"uuid", "123e4567-e89b-12d3-a456-426614174000", "123e4567"},
+	}
+	for _, tt := range tests {
+		schema, err := Parse([]byte(`{"type":"string","format":"` + tt.format + `"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if errs := schema.Validate(tt.valid); errs != nil {
+			t.Errorf("%s: Validate(%q) = %v", tt.format, tt.valid, errs)
+		}
+		if errs := schema.Validate(tt.invalid); len(errs) != 1 {
+			t.Errorf("%s: Validate(%q) = %v, want one error", tt.format, tt.invalid, errs)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		schema, err string
+	}{
+		{`{"type":"text"}`, `invalid type "text"`},
+		{`{"type":"string","pattern":"("}`, "invalid pattern"},
+		{`{"properties":{"a":{"type":"bool"}}}`, `property a: invalid type "bool"`},
+		{`{`, ""},
+	}
+	for _, tt := range tests {
+		_, err := Parse([]byte(tt.schema))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Parse(%s) error = %v, want %s", tt.schema, err, tt.err)
+		}
+	}
+}
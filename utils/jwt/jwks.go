@@ -0,0 +1,220 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/haierspi/pt-gateway/utils/ptjson"
+)
+
+// minRefreshInterval 遇到未知kid时重新加载的最小间隔，防止被用来刷JWKS地址
+const minRefreshInterval = 10 * time.Second
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// KeySet JWKS，从本地文件或http(s)地址加载，缓存ttl后重新加载
+//
+// 过期后先用旧的公钥，在后台重新加载，加载时不阻塞其他请求
+type KeySet struct {
+	source string
+	ttl    time.Duration
+	client *http.Client
+
+	loadMu sync.Mutex // 同一时间只加载一次
+
+	mu      sync.Mutex
+	keys    map[string]interface{}
+	fetched time.Time
+	err     error // 最近一次加载的错误
+}
+
+// NewKeySet NewKeySet
+func NewKeySet(source string, ttl time.Duration) *KeySet {
+	return &KeySet{
+		source: source,
+		ttl:    ttl,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Key 按kid取公钥，kid为空且只有一个公钥时返回该公钥
+func (s *KeySet) Key(kid string) (interface{}, error) {
+	keys, fetched := s.snapshot()
+	if keys == nil {
+		if err := s.refresh(fetched); err != nil {
+			return nil, err
+		}
+		keys, fetched = s.snapshot()
+	} else if time.Since(fetched) > s.ttl && s.loadMu.TryLock() {
+		go func() {
+			defer s.loadMu.Unlock()
+			s.load()
+		}()
+	}
+	key, ok := lookup(keys, kid)
+	if !ok && time.Since(fetched) > minRefreshInterval {
+		// 可能是密钥轮换，重新加载一次
+		if err := s.refresh(fetched); err != nil {
+			return nil, err
+		}
+		keys, _ = s.snapshot()
+		key, ok = lookup(keys, kid)
+	}
+	if !ok {
+		return nil, fmt.Errorf("jwt: unknown key %q", kid)
+	}
+	return key, nil
+}
+
+// KeyFunc 用于Verify
+func (s *KeySet) KeyFunc(header *Header) (interface{}, error) {
+	return s.Key(header.Kid)
+}
+
+func (s *KeySet) snapshot() (map[string]interface{}, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.keys, s.fetched
+}
+
+func lookup(keys map[string]interface{}, kid string) (interface{}, bool) {
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, true
+		}
+	}
+	key, ok := keys[kid]
+	return key, ok
+}
+
+// refresh 重新加载，seen之后已经有其他请求加载过时不再加载，返回那次的结果
+func (s *KeySet) refresh(seen time.Time) error {
+	s.loadMu.Lock()
+	defer s.loadMu.Unlock()
+	s.mu.Lock()
+	loaded, err := s.fetched.After(seen), s.err
+	s.mu.Unlock()
+	if loaded {
+		return err
+	}
+	return s.load()
+}
+
+// load 读取并解析JWKS，调用方持有loadMu，失败时保留之前的公钥
+func (s *KeySet) load() error {
+	keys, err := s.parse()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fetched = time.Now()
+	s.err = err
+	if err == nil {
+		s.keys = keys
+	}
+	return err
+}
+
+// parse 不支持的公钥（如OKP、P-384）跳过，一个可用的都没有时返回错误
+func (s *KeySet) parse() (map[string]interface{}, error) {
+	data, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := ptjson.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	keys := map[string]interface{}{}
+	var lastErr error
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			lastErr = fmt.Errorf("key %q: %w", jwk.Kid, err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	if len(keys) == 0 && lastErr != nil {
+		return nil, fmt.Errorf("jwt: no usable keys in %s: %w", s.source, lastErr)
+	}
+	return keys, nil
+}
+
+func (s *KeySet) read() ([]byte, error) {
+	if !strings.HasPrefix(s.source, "http://") && !strings.HasPrefix(s.source, "https://") {
+		return os.ReadFile(s.source)
+	}
+	resp, err := s.client.Get(s.source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jwt: fetch %s: %s", s.source, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (jwk *jsonWebKey) publicKey() (interface{}, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if jwk.Crv != "P-256" {
+			return nil, fmt.Errorf("jwt: unsupported curve %s", jwk.Crv)
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, errors.New("jwt: invalid EC key")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("jwt: unsupported key type %s", jwk.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,133 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func rsaJWK(kid string, key *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA",
+		"kid": kid,
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func writeJWKS(t *testing.T, keys ...map[string]string) string {
+	t.Helper()
+	data, err := json.Marshal(map[string]interface{}{"keys": keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(file, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestKeySetSkipsUnsupportedKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := writeJWKS(t,
+		map[string]string{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"},
+		map[string]string{"kty": "EC", "kid": "p384", "crv": "P-384", "x": "AA", "y": "AA"},
+		rsaJWK("rsa", &rsaKey.PublicKey),
+	)
+	s := NewKeySet(file, time.Hour)
+
+	token := sign(t, Header{Alg: "RS256", Kid: "rsa"}, Claims{"sub": "u1"}, rsaKey)
+	if _, err := Verify(token, s.KeyFunc); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if _, err := s.Key("ed"); err == nil || !strings.Contains(err.Error(), "unknown key") {
+		t.Fatalf("Key(ed) error = %v, want unknown key", err)
+	}
+}
+
+func TestKeySetNoUsableKeys(t *testing.T) {
+	file := writeJWKS(t, map[string]string{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": "AA"})
+	if _, err := NewKeySet(file, time.Hour).Key("ed"); err == nil || !strings.Contains(err.Error(), "no usable keys") {
+		t.Fatalf("Key() error = %v, want no usable keys", err)
+	}
+}
+
+func TestKeySetUnknownKid(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewKeySet(writeJWKS(t, rsaJWK("a", &rsaKey.PublicKey)), time.Hour)
+	token := sign(t, Header{Alg: "RS256", Kid: "b"}, Claims{}, rsaKey)
+	if _, err := Verify(token, s.KeyFunc); err == nil || !strings.Contains(err.Error(), `unknown key "b"`) {
+		t.Fatalf("Verify() error = %v, want unknown key", err)
+	}
+	// kid为空且只有一个公钥时使用该公钥
+	token = sign(t, Header{Alg: "RS256"}, Claims{}, rsaKey)
+	if _, err := Verify(token, s.KeyFunc); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+}
+
+// 过期后在后台重新加载，加载时仍然用旧的公钥
+func TestKeySetRefreshDoesNotBlock(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(map[string]interface{}{"keys": []interface{}{rsaJWK("a", &rsaKey.PublicKey)}})
+	var requests int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) > 1 {
+			<-release
+		}
+		w.Write(data)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	s := NewKeySet(server.URL, time.Millisecond)
+	if _, err := s.Key("a"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	done := make(chan error)
+	go func() {
+		_, err := s.Key("a")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Key blocked while refreshing")
+	}
+}
+
+func TestKeySetFetchError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	_, err := NewKeySet(server.URL, time.Hour).Key("a")
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Fatalf("Key() error = %v, want 503", err)
+	}
+}
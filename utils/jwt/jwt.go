@@ -0,0 +1,172 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/haierspi/pt-gateway/utils/ptjson"
+)
+
+// vars
+var (
+	ErrMalformed    = errors.New("jwt: malformed token")
+	ErrAlgorithm    = errors.New("jwt: unsupported algorithm")
+	ErrSignature    = errors.New("jwt: invalid signature")
+	ErrExpired      = errors.New("jwt: token is expired")
+	ErrNotValidYet  = errors.New("jwt: token is not valid yet")
+	ErrInvalidClaim = errors.New("jwt: invalid claim")
+)
+
+// Header JWT头
+type Header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+// Claims JWT载荷
+type Claims map[string]interface{}
+
+// KeyFunc 根据头部返回验证密钥：HS256为[]byte，RS256为*rsa.PublicKey，ES256为*ecdsa.PublicKey
+type KeyFunc func(header *Header) (interface{}, error)
+
+// Verify 验证签名并返回载荷，支持HS256、RS256、ES256，不检查exp等声明，见Claims.Validate
+func Verify(token string, keyFunc KeyFunc) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+	var header Header
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrMalformed
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	key, err := keyFunc(&header)
+	if err != nil {
+		return nil, err
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	digest := sha256.Sum256(signed)
+	// 密钥类型必须和alg一致，防止用公钥当HMAC密钥伪造签名
+	switch header.Alg {
+	case "HS256":
+		secret, ok := key.([]byte)
+		if !ok {
+			return nil, ErrAlgorithm
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return nil, ErrSignature
+		}
+	case "RS256":
+		publicKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return nil, ErrAlgorithm
+		}
+		if rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature) != nil {
+			return nil, ErrSignature
+		}
+	case "ES256":
+		publicKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return nil, ErrAlgorithm
+		}
+		if len(signature) != 64 {
+			return nil, ErrSignature
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(publicKey, digest[:], r, s) {
+			return nil, ErrSignature
+		}
+	default:
+		return nil, ErrAlgorithm
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrMalformed
+	}
+	return claims, nil
+}
+
+// Validate 检查exp、nbf，issuer、audience不为空时检查iss、aud
+func (c Claims) Validate(now time.Time, leeway time.Duration, issuer, audience string) error {
+	if exp, ok := c.number("exp"); ok && now.After(time.Unix(exp, 0).Add(leeway)) {
+		return ErrExpired
+	}
+	if nbf, ok := c.number("nbf"); ok && now.Add(leeway).Before(time.Unix(nbf, 0)) {
+		return ErrNotValidYet
+	}
+	if issuer != "" && c.String("iss") != issuer {
+		return fmt.Errorf("%w: iss", ErrInvalidClaim)
+	}
+	if audience != "" && !c.hasAudience(audience) {
+		return fmt.Errorf("%w: aud", ErrInvalidClaim)
+	}
+	return nil
+}
+
+// String 字符串声明，不存在或不是字符串时返回空
+func (c Claims) String(name string) string {
+	val, _ := c[name].(string)
+	return val
+}
+
+// Strings 字符串数组声明，也支持空格或逗号分隔的字符串（如scope）
+func (c Claims) Strings(name string) []string {
+	switch val := c[name].(type) {
+	case string:
+		return strings.FieldsFunc(val, func(r rune) bool { return r == ' ' || r == ',' })
+	case []interface{}:
+		vals := make([]string, 0, len(val))
+		for _, v := range val {
+			if s, ok := v.(string); ok {
+				vals = append(vals, s)
+			}
+		}
+		return vals
+	}
+	return nil
+}
+
+func (c Claims) number(name string) (int64, bool) {
+	switch val := c[name].(type) {
+	case float64:
+		return int64(val), true
+	case int64:
+		return val, true
+	}
+	return 0, false
+}
+
+func (c Claims) hasAudience(audience string) bool {
+	for _, aud := range c.Strings("aud") {
+		if aud == audience {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return ptjson.Unmarshal(data, v)
+}
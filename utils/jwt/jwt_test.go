@@ -0,0 +1,149 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func encodeSegment(t *testing.T, v interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// sign 按header的alg签名，key为[]byte、*rsa.PrivateKey或*ecdsa.PrivateKey
+func sign(t *testing.T, header Header, claims Claims, key interface{}) string {
+	t.Helper()
+	signed := encodeSegment(t, header) + "." + encodeSegment(t, claims)
+	digest := sha256.Sum256([]byte(signed))
+	var signature []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func staticKey(key interface{}) KeyFunc {
+	return func(*Header) (interface{}, error) { return key, nil }
+}
+
+func TestVerify(t *testing.T) {
+	secret := []byte("secret")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherRSA, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := Claims{"sub": "u1"}
+
+	tests := []struct {
+		name  string
+		token string
+		key   interface{}
+		err   error
+	}{
+		{"HS256", sign(t, Header{Alg: "HS256"}, claims, secret), secret, nil},
+		{"RS256", sign(t, Header{Alg: "RS256"}, claims, rsaKey), &rsaKey.PublicKey, nil},
+		{"ES256", sign(t, Header{Alg: "ES256"}, claims, ecKey), &ecKey.PublicKey, nil},
+		{"HS256 wrong secret", sign(t, Header{Alg: "HS256"}, claims, secret), []byte("other"), ErrSignature},
+		{"RS256 other key", sign(t, Header{Alg: "RS256"}, claims, otherRSA), &rsaKey.PublicKey, ErrSignature},
+		{"ES256 truncated signature", sign(t, Header{Alg: "ES256"}, claims, ecKey)[:100], &ecKey.PublicKey, ErrSignature},
+		{"ES256 other key", sign(t, Header{Alg: "ES256"}, claims, ecKey), &rsaKey.PublicKey, ErrAlgorithm},
+		// 用RSA公钥当HMAC密钥伪造签名
+		{"HS256 with RSA key", sign(t, Header{Alg: "HS256"}, claims, secret), &rsaKey.PublicKey, ErrAlgorithm},
+		{"RS256 with secret", sign(t, Header{Alg: "RS256"}, claims, rsaKey), secret, ErrAlgorithm},
+		{"alg none", encodeSegment(t, Header{Alg: "none"}) + "." + encodeSegment(t, claims) + ".", secret, ErrAlgorithm},
+		{"malformed", "a.b", secret, ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Verify(tt.token, staticKey(tt.key))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.err)
+			}
+			if err == nil && got.String("sub") != "u1" {
+				t.Fatalf("Verify() claims = %v", got)
+			}
+		})
+	}
+}
+
+func TestVerifyTamperedClaims(t *testing.T) {
+	secret := []byte("secret")
+	token := sign(t, Header{Alg: "HS256"}, Claims{"sub": "u1"}, secret)
+	other := sign(t, Header{Alg: "HS256"}, Claims{"sub": "admin"}, []byte("x"))
+	parts, otherParts := strings.Split(token, "."), strings.Split(other, ".")
+	tampered := parts[0] + "." + otherParts[1] + "." + parts[2]
+	if _, err := Verify(tampered, staticKey(secret)); !errors.Is(err, ErrSignature) {
+		t.Fatalf("Verify() error = %v, want %v", err, ErrSignature)
+	}
+}
+
+func TestClaimsValidate(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tests := []struct {
+		name   string
+		claims Claims
+		leeway time.Duration
+		err    error
+	}{
+		{"valid", Claims{"exp": float64(now.Unix() + 60), "nbf": float64(now.Unix() - 60)}, 0, nil},
+		{"expired", Claims{"exp": float64(now.Unix() - 1)}, 0, ErrExpired},
+		{"expired within leeway", Claims{"exp": float64(now.Unix() - 1)}, time.Minute, nil},
+		{"not valid yet", Claims{"nbf": float64(now.Unix() + 60)}, 0, ErrNotValidYet},
+		{"nbf within leeway", Claims{"nbf": float64(now.Unix() + 30)}, time.Minute, nil},
+		{"issuer", Claims{"iss": "other"}, 0, ErrInvalidClaim},
+		{"audience", Claims{"iss": "pt", "aud": []interface{}{"a", "b"}}, 0, ErrInvalidClaim},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer, audience := "", ""
+			if _, ok := tt.claims["iss"]; ok {
+				issuer = "pt"
+			}
+			if _, ok := tt.claims["aud"]; ok {
+				audience = "gateway"
+			}
+			if err := tt.claims.Validate(now, tt.leeway, issuer, audience); !errors.Is(err, tt.err) {
+				t.Fatalf("Validate() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
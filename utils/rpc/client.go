@@ -4,16 +4,15 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/rpc"
-	"os"
 	"strconv"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/haierspi/pt-gateway/utils/ptjson"
-	"github.com/pborman/uuid"
 	"github.com/streadway/amqp"
 )
 
@@ -24,9 +23,8 @@ var (
 
 // Client rpc Client
 type Client struct {
-	url       string
 	mu        sync.Mutex
-	conn      *amqp.Connection
+	transport Transport
 	clientMap map[string]*rpc.Client
 
 	Timeout int64
@@ -43,22 +41,21 @@ func Dial(url string) (*Client, error) {
 
 // NewClientWithConn NewClientWithConn
 func NewClientWithConn(conn *amqp.Connection, url string) *Client {
+	return NewClientWithTransport(NewAMQPTransport(conn, url))
+}
+
+// NewClientWithTransport 使用指定的传输，如NewMemoryTransport
+func NewClientWithTransport(transport Transport) *Client {
 	return &Client{
-		url:       url,
-		conn:      conn,
+		transport: transport,
 		clientMap: make(map[string]*rpc.Client),
 		Timeout:   20,
 	}
 }
 
-// reconn to MQ Server
-func (client *Client) reconn() {
-	if conn, err := amqp.Dial(client.url); err != nil {
-		log.Println(err)
-	} else {
-		log.Println("reconn")
-		client.conn = conn
-	}
+// SetTimeout 修改超时秒数，调用过程中也可以安全修改
+func (client *Client) SetTimeout(seconds int64) {
+	atomic.StoreInt64(&client.Timeout, seconds)
 }
 
 // JSONCall Call
@@ -67,7 +64,8 @@ func (client *Client) JSONCall(queue string, serviceMethod string, args *[]byte,
 	if err != nil {
 		return err
 	}
-	timeout := time.NewTimer(time.Second * time.Duration(client.Timeout))
+	timeoutSeconds := atomic.LoadInt64(&client.Timeout)
+	timeout := time.NewTimer(time.Second * time.Duration(timeoutSeconds))
 	select {
 	case call := <-c.Go(serviceMethod, args, reply, make(chan *rpc.Call, 1)).Done:
 		if call.Error == rpc.ErrShutdown && !(len(isChildCall) == 1 && isChildCall[0] == true) {
@@ -78,7 +76,7 @@ func (client *Client) JSONCall(queue string, serviceMethod string, args *[]byte,
 		}
 		return call.Error
 	case <-timeout.C: //3s timeout
-		return fmt.Errorf("timeout %ds", client.Timeout)
+		return fmt.Errorf("timeout %ds", timeoutSeconds)
 	}
 }
 
@@ -116,44 +114,13 @@ func (client *Client) jsonClient(queue string) (*rpc.Client, error) {
 	if ok {
 		return c, nil
 	}
-	ch, err := client.conn.Channel()
-	if err != nil {
-		client.reconn()
-		if ch, err = client.conn.Channel(); err != nil {
-			return nil, errors.New("Failed to open a channel")
-		}
-	}
-	if q, err := ch.QueueInspect(queue); err != nil && q.Consumers == 0 {
-		return nil, errors.New("No such service: " + queue)
-	}
-	q, err := ch.QueueDeclare(
-		strings.Replace(os.Args[0], "./", "", -1)+"."+queue+"."+uuid.New(), // name
-		false, // durable
-		true,  // delete when usused
-		true,  // exclusive
-		false, // noWait
-		nil,   // arguments
-	)
+	ep, err := client.transport.Dial(queue)
 	if err != nil {
-		return nil, errors.New("Failed to declare a queue")
-	}
-	msgs, err := ch.Consume(
-		q.Name, // queue
-		"",     // consumer
-		true,   // autoAck
-		false,  // exclusive
-		false,  // noLocal
-		false,  // noWait
-		nil,    // arguments
-	)
-	if err != nil {
-		return nil, errors.New("Failed to register a consumer")
+		return nil, err
 	}
 	codec := &jsonClientCodec{
 		queue:     queue,
-		replyTo:   q.Name,
-		ch:        ch,
-		msgs:      msgs,
+		ep:        ep,
 		pending:   make(map[uint64]string),
 		clientMap: client.clientMap,
 	}
@@ -165,11 +132,9 @@ func (client *Client) jsonClient(queue string) (*rpc.Client, error) {
 type jsonClientCodec struct {
 	sync.Mutex
 	queue     string
-	replyTo   string
 	req       jsonClientRequest
 	resp      jsonClientResponse
-	ch        *amqp.Channel
-	msgs      <-chan amqp.Delivery
+	ep        Endpoint
 	pending   map[uint64]string
 	clientMap map[string]*rpc.Client
 }
@@ -202,29 +167,25 @@ func (c *jsonClientCodec) WriteRequest(r *rpc.Request, body interface{}) error {
 	if err != nil {
 		return err
 	}
-	return c.ch.Publish(
-		"",      // exchange
-		c.queue, // routing key
-		false,   // mandatory
-		false,   // immediate
-		amqp.Publishing{
-			ContentType:   "application/json",
-			CorrelationId: strconv.FormatUint(r.Seq, 10),
-			ReplyTo:       c.replyTo,
-			Body:          b,
-		},
-	)
+	return c.ep.Publish(c.queue, Message{
+		CorrelationID: strconv.FormatUint(r.Seq, 10),
+		ReplyTo:       c.ep.Name(),
+		Body:          b,
+	})
 }
 
 func (c *jsonClientCodec) ReadResponseHeader(r *rpc.Response) error {
 	timeout := time.NewTimer(time.Second * 3600)
 	select {
-	case msg := <-c.msgs:
+	case msg, ok := <-c.ep.Messages():
+		if !ok {
+			return io.EOF
+		}
 		c.resp.reset()
 		if err := ptjson.Unmarshal(msg.Body, &c.resp); err != nil {
 			return err
 		}
-		seq, err := strconv.ParseUint(msg.CorrelationId, 0, 64)
+		seq, err := strconv.ParseUint(msg.CorrelationID, 0, 64)
 		if err != nil {
 			return err
 		}
@@ -262,5 +223,5 @@ func (c *jsonClientCodec) ReadResponseBody(body interface{}) error {
 
 func (c *jsonClientCodec) Close() error {
 	delete(c.clientMap, c.queue)
-	return c.ch.Close()
+	return c.ep.Close()
 }
@@ -0,0 +1,153 @@
+package rpc
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+)
+
+// memoryQueueSize 进程内队列的缓冲
+const memoryQueueSize = 1024
+
+// MemoryTransport 进程内传输，同一进程的Server和Client通过channel通信，不需要RabbitMQ
+//
+//	t := rpc.NewMemoryTransport()
+//	server := rpc.NewServer()
+//	server.Register(new(Examples))
+//	go server.ServeTransport(t, "examples_1.0")
+//	client := rpc.NewClientWithTransport(t)
+type MemoryTransport struct {
+	mu     sync.Mutex
+	queues map[string]*memoryQueue
+	seq    uint64
+}
+
+// memoryQueue 与AMQP一致：服务队列没有消费者时删除，回复队列随客户端关闭删除
+type memoryQueue struct {
+	name      string
+	ch        chan Message
+	done      chan struct{}
+	consumers int
+}
+
+// NewMemoryTransport 创建进程内传输
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{queues: map[string]*memoryQueue{}}
+}
+
+func (t *MemoryTransport) Listen(queue string) (Endpoint, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	q, ok := t.queues[queue]
+	if !ok {
+		q = &memoryQueue{name: queue, ch: make(chan Message, memoryQueueSize), done: make(chan struct{})}
+		t.queues[queue] = q
+	}
+	q.consumers++
+	return newMemoryEndpoint(t, q), nil
+}
+
+func (t *MemoryTransport) Dial(queue string) (Endpoint, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if q, ok := t.queues[queue]; !ok || q.consumers == 0 {
+		return nil, errors.New("No such service: " + queue)
+	}
+	t.seq++
+	name := "memory." + queue + "." + strconv.FormatUint(t.seq, 10)
+	q := &memoryQueue{name: name, ch: make(chan Message, memoryQueueSize), done: make(chan struct{}), consumers: 1}
+	t.queues[name] = q
+	return newMemoryEndpoint(t, q), nil
+}
+
+// Close 关闭全部队列，Server和Client的读取随之结束
+func (t *MemoryTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for name, q := range t.queues {
+		close(q.done)
+		delete(t.queues, name)
+	}
+	return nil
+}
+
+// publish 发送到队列，队列不存在时丢弃，与AMQP的默认exchange一致
+func (t *MemoryTransport) publish(queue string, msg Message) error {
+	t.mu.Lock()
+	q, ok := t.queues[queue]
+	t.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	select {
+	case q.ch <- msg:
+		return nil
+	case <-q.done:
+		return nil
+	}
+}
+
+// release 消费者关闭，没有消费者时删除队列
+func (t *MemoryTransport) release(q *memoryQueue) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.queues[q.name] != q {
+		return
+	}
+	if q.consumers--; q.consumers == 0 {
+		close(q.done)
+		delete(t.queues, q.name)
+	}
+}
+
+type memoryEndpoint struct {
+	t         *MemoryTransport
+	q         *memoryQueue
+	msgs      chan Message
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newMemoryEndpoint(t *MemoryTransport, q *memoryQueue) *memoryEndpoint {
+	e := &memoryEndpoint{t: t, q: q, msgs: make(chan Message), done: make(chan struct{})}
+	go func() {
+		defer close(e.msgs)
+		for {
+			select {
+			case msg := <-q.ch:
+				select {
+				case e.msgs <- msg:
+				case <-e.done:
+					return
+				}
+			case <-q.done:
+				return
+			case <-e.done:
+				return
+			}
+		}
+	}()
+	return e
+}
+
+func (e *memoryEndpoint) Name() string {
+	return e.q.name
+}
+
+func (e *memoryEndpoint) Messages() <-chan Message {
+	return e.msgs
+}
+
+func (e *memoryEndpoint) Publish(queue string, msg Message) error {
+	// 与AMQP一样复制一份，防止收发双方共用Body
+	msg.Body = append([]byte(nil), msg.Body...)
+	return e.t.publish(queue, msg)
+}
+
+func (e *memoryEndpoint) Close() error {
+	e.closeOnce.Do(func() {
+		close(e.done)
+		e.t.release(e.q)
+	})
+	return nil
+}
@@ -0,0 +1,144 @@
+package rpc
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type EchoArgs struct {
+	Body  string
+	Sleep time.Duration
+}
+
+type EchoReply struct {
+	Body string
+}
+
+type Examples struct{}
+
+func (Examples) Echo(args *EchoArgs, reply *EchoReply) error {
+	time.Sleep(args.Sleep)
+	reply.Body = args.Body
+	return nil
+}
+
+func (Examples) Fail(args *EchoArgs, reply *EchoReply) error {
+	return errors.New("failed: " + args.Body)
+}
+
+// serveMemory 在MemoryTransport上启动examples_1.0服务，返回ServeTransport的结果
+func serveMemory(t *testing.T, transport *MemoryTransport) <-chan error {
+	t.Helper()
+	server := NewServer()
+	if err := server.Register(new(Examples)); err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- server.ServeTransport(transport, "examples_1.0") }()
+	// 等待Listen，之后Dial才能找到服务
+	deadline := time.Now().Add(time.Second)
+	for {
+		if ep, err := transport.Dial("examples_1.0"); err == nil {
+			ep.Close()
+			return served
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("server not listening")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMemoryJSONCall(t *testing.T) {
+	transport := NewMemoryTransport()
+	defer transport.Close()
+	serveMemory(t, transport)
+	client := NewClientWithTransport(transport)
+
+	args := []byte(`{"Body":"hi"}`)
+	var reply []byte
+	if err := client.JSONCall("examples_1.0", "Examples.Echo", &args, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if string(reply) != `{"Body":"hi"}` {
+		t.Fatalf("reply = %s", reply)
+	}
+
+	var typed EchoReply
+	if err := client.Call("examples_1.0", "Examples.Echo", EchoArgs{Body: "typed"}, &typed); err != nil {
+		t.Fatal(err)
+	}
+	if typed.Body != "typed" {
+		t.Fatalf("reply = %+v", typed)
+	}
+}
+
+func TestMemoryBackendError(t *testing.T) {
+	transport := NewMemoryTransport()
+	defer transport.Close()
+	serveMemory(t, transport)
+	client := NewClientWithTransport(transport)
+
+	args := []byte(`{"Body":"x"}`)
+	var reply []byte
+	err := client.JSONCall("examples_1.0", "Examples.Fail", &args, &reply)
+	if err == nil || err.Error() != "failed: x" {
+		t.Fatalf("error = %v, want failed: x", err)
+	}
+	err = client.JSONCall("examples_1.0", "Examples.Missing", &args, &reply)
+	if err == nil || !strings.Contains(err.Error(), "can't find method") {
+		t.Fatalf("error = %v, want can't find method", err)
+	}
+	// 出错后连接仍然可用
+	if err := client.JSONCall("examples_1.0", "Examples.Echo", &args, &reply); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMemoryTimeout(t *testing.T) {
+	transport := NewMemoryTransport()
+	defer transport.Close()
+	serveMemory(t, transport)
+	client := NewClientWithTransport(transport)
+	client.SetTimeout(1)
+
+	args := []byte(`{"Body":"slow","Sleep":1500000000}`)
+	var reply []byte
+	start := time.Now()
+	err := client.JSONCall("examples_1.0", "Examples.Echo", &args, &reply)
+	if err == nil || err.Error() != "timeout 1s" {
+		t.Fatalf("error = %v, want timeout 1s", err)
+	}
+	if elapsed := time.Since(start); elapsed > 1400*time.Millisecond {
+		t.Fatalf("timeout after %v", elapsed)
+	}
+}
+
+func TestMemoryNoSuchService(t *testing.T) {
+	transport := NewMemoryTransport()
+	defer transport.Close()
+	client := NewClientWithTransport(transport)
+
+	args := []byte(`{}`)
+	var reply []byte
+	err := client.JSONCall("missing_1.0", "Missing.Echo", &args, &reply)
+	if err == nil || !strings.Contains(err.Error(), "No such service: missing_1.0") {
+		t.Fatalf("error = %v, want No such service", err)
+	}
+}
+
+func TestMemoryServeTransportReturnsOnClose(t *testing.T) {
+	transport := NewMemoryTransport()
+	served := serveMemory(t, transport)
+	transport.Close()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ServeTransport did not return after Close")
+	}
+}
@@ -5,10 +5,47 @@ type CommonReply struct {
 	ErrorCode int64
 	ErrorMsg  string
 	Data      interface{}
+	HTTP      *HTTPReply `json:",omitempty"`
 }
 
 // BodyReply 用于提供给三方调用，如支付回调，Body为内容，ContentType为文本类型：application/json，text/plain，text/xml等
+//
+// 图片、文件等二进制内容同样放在Body中（json中为base64编码），较大的内容可以只返回BodyRef，由网关读取后输出
 type BodyReply struct {
 	Body        []byte
 	ContentType string
+
+	// BodyRef 内容引用，http(s)地址或网关blobRoot下的相对路径，不为空时忽略Body
+	BodyRef string
+	// FileName 文件名，不为空时输出Content-Disposition
+	FileName string
+	// Inline 与FileName一起使用，true为inline（浏览器直接展示），否则为attachment（下载）
+	Inline bool
+	// MaxAge 缓存秒数，大于0时输出Cache-Control和Expires
+	MaxAge int64
+	// HTTP 状态码、响应头、Cookie和跳转
+	HTTP *HTTPReply `json:",omitempty"`
+}
+
+// HTTPReply 后端控制的HTTP响应，如支付同步回跳、OAuth回调需要302跳转，所有字段均可选
+//
+// BodyReply的HTTP字段，或者普通json回复（如CommonReply）中顶层的"HTTP"字段；
+// 普通json回复需要路由配置httpReply=true，网关输出前会去掉该字段，未配置时回复原样返回
+type HTTPReply struct {
+	StatusCode int               // 为0时有Location则302，否则200
+	Header     map[string]string // 额外的响应头
+	Cookies    []Cookie
+	Location   string // 跳转地址
+}
+
+// Cookie 响应Cookie，SameSite为Lax、Strict、None
+type Cookie struct {
+	Name     string
+	Value    string
+	Path     string
+	Domain   string
+	MaxAge   int
+	Secure   bool
+	HttpOnly bool
+	SameSite string
 }
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/rpc"
 	"sync"
@@ -45,41 +46,28 @@ func (server *Server) Serve(url string, queue string) {
 
 // ServeConn ServeConn
 func (server *Server) ServeConn(conn *amqp.Connection, queue string) {
-	ch, err := conn.Channel()
-	failOnError(err, "Failed to open a channel")
-	q, err := ch.QueueDeclare(
-		queue, // name
-		false, // durable
-		true,  // delete when usused
-		false, // exclusive
-		false, // noWait
-		nil,   // arguments
-	)
-	failOnError(err, "Failed to declare a queue")
-	msgs, err := ch.Consume(
-		q.Name, // queue
-		"",     // consumer
-		true,   // autoAck
-		false,  // exclusive
-		false,  // noLocal
-		false,  // noWait
-		nil,    // arguments
-	)
-	failOnError(err, "Failed to register a consumer")
+	transport := NewAMQPTransport(conn, "")
+	defer transport.Close()
+	failOnError(server.ServeTransport(transport, queue), "Failed to serve")
+}
+
+// ServeTransport 在transport上提供queue服务，阻塞到transport关闭
+func (server *Server) ServeTransport(transport Transport, queue string) error {
+	ep, err := transport.Listen(queue)
+	if err != nil {
+		return err
+	}
 	codec := &serverCodec{
-		conn:    conn,
-		ch:      ch,
-		msgs:    msgs,
+		ep:      ep,
 		pending: make(map[uint64]prop),
 	}
 	server.s.ServeCodec(codec)
+	return nil
 }
 
 type serverCodec struct {
 	sync.Mutex
-	conn    *amqp.Connection
-	ch      *amqp.Channel
-	msgs    <-chan amqp.Delivery
+	ep      Endpoint
 	req     serverRequest
 	seq     uint64
 	pending map[uint64]prop
@@ -106,7 +94,10 @@ type prop struct {
 }
 
 func (c *serverCodec) ReadRequestHeader(r *rpc.Request) error {
-	msg := <-c.msgs
+	msg, ok := <-c.ep.Messages()
+	if !ok {
+		return io.EOF
+	}
 	c.req.reset()
 	if err := ptjson.Unmarshal(msg.Body, &c.req); err != nil {
 		return err
@@ -114,7 +105,7 @@ func (c *serverCodec) ReadRequestHeader(r *rpc.Request) error {
 	r.ServiceMethod = c.req.Method
 	c.Lock()
 	c.seq++
-	c.pending[c.seq] = prop{msg.CorrelationId, msg.ReplyTo}
+	c.pending[c.seq] = prop{msg.CorrelationID, msg.ReplyTo}
 	r.Seq = c.seq
 	c.Unlock()
 
@@ -153,21 +144,14 @@ func (c *serverCodec) WriteResponse(r *rpc.Response, body interface{}) error {
 	if err != nil {
 		return err
 	}
-	return c.ch.Publish(
-		"",           // exchange
-		prop.replyTo, // routing key
-		false,        // mandatory
-		false,        // immediate
-		amqp.Publishing{
-			ContentType:   "application/json",
-			CorrelationId: prop.correlationID,
-			Body:          b,
-		},
-	)
+	return c.ep.Publish(prop.replyTo, Message{
+		CorrelationID: prop.correlationID,
+		Body:          b,
+	})
 }
 
 func (c *serverCodec) Close() error {
-	return c.conn.Close()
+	return c.ep.Close()
 }
 
 func failOnError(err error, msg string) {
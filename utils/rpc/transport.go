@@ -0,0 +1,184 @@
+package rpc
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pborman/uuid"
+	"github.com/streadway/amqp"
+)
+
+// Message 客户端和服务端之间传输的一条消息
+type Message struct {
+	CorrelationID string
+	ReplyTo       string // 请求的回复队列，回复时为空
+	Body          []byte
+}
+
+// Transport 消息传输，jsonClientCodec和serverCodec通过Endpoint收发消息
+//
+// NewAMQPTransport使用RabbitMQ，NewMemoryTransport在进程内通过channel传输，用于测试
+type Transport interface {
+	// Listen 服务端声明服务队列queue，同一队列的多个Listen轮流接收请求
+	Listen(queue string) (Endpoint, error)
+	// Dial 客户端为调用queue声明独占的回复队列，queue没有服务时返回错误
+	Dial(queue string) (Endpoint, error)
+	Close() error
+}
+
+// Endpoint 一个队列的收发
+type Endpoint interface {
+	// Name 接收消息的队列名，客户端作为请求的ReplyTo
+	Name() string
+	// Messages 收到的消息，Close后关闭
+	Messages() <-chan Message
+	// Publish 发送到queue，queue不存在时丢弃
+	Publish(queue string, msg Message) error
+	Close() error
+}
+
+// amqpTransport RabbitMQ传输，获取channel失败时重新连接
+type amqpTransport struct {
+	url  string
+	mu   sync.Mutex
+	conn *amqp.Connection
+}
+
+// NewAMQPTransport 使用已有的连接，url不为空时用于断线重连
+func NewAMQPTransport(conn *amqp.Connection, url string) Transport {
+	return &amqpTransport{url: url, conn: conn}
+}
+
+// channel 打开channel，失败时重新连接一次
+func (t *amqpTransport) channel() (*amqp.Channel, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ch, err := t.conn.Channel()
+	if err == nil || t.url == "" {
+		return ch, err
+	}
+	if conn, err := amqp.Dial(t.url); err != nil {
+		log.Println(err)
+	} else {
+		log.Println("reconn")
+		t.conn = conn
+	}
+	return t.conn.Channel()
+}
+
+func (t *amqpTransport) Listen(queue string) (Endpoint, error) {
+	ch, err := t.channel()
+	if err != nil {
+		return nil, errors.New("Failed to open a channel")
+	}
+	q, err := ch.QueueDeclare(
+		queue, // name
+		false, // durable
+		true,  // delete when usused
+		false, // exclusive
+		false, // noWait
+		nil,   // arguments
+	)
+	if err != nil {
+		ch.Close()
+		return nil, errors.New("Failed to declare a queue")
+	}
+	return consume(ch, q.Name)
+}
+
+func (t *amqpTransport) Dial(queue string) (Endpoint, error) {
+	ch, err := t.channel()
+	if err != nil {
+		return nil, errors.New("Failed to open a channel")
+	}
+	if q, err := ch.QueueInspect(queue); err != nil && q.Consumers == 0 {
+		ch.Close()
+		return nil, errors.New("No such service: " + queue)
+	}
+	q, err := ch.QueueDeclare(
+		strings.Replace(os.Args[0], "./", "", -1)+"."+queue+"."+uuid.New(), // name
+		false, // durable
+		true,  // delete when usused
+		true,  // exclusive
+		false, // noWait
+		nil,   // arguments
+	)
+	if err != nil {
+		ch.Close()
+		return nil, errors.New("Failed to declare a queue")
+	}
+	return consume(ch, q.Name)
+}
+
+func (t *amqpTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.conn.Close()
+}
+
+func consume(ch *amqp.Channel, queue string) (Endpoint, error) {
+	deliveries, err := ch.Consume(
+		queue, // queue
+		"",    // consumer
+		true,  // autoAck
+		false, // exclusive
+		false, // noLocal
+		false, // noWait
+		nil,   // arguments
+	)
+	if err != nil {
+		ch.Close()
+		return nil, errors.New("Failed to register a consumer")
+	}
+	e := &amqpEndpoint{ch: ch, name: queue, msgs: make(chan Message), done: make(chan struct{})}
+	go func() {
+		defer close(e.msgs)
+		for d := range deliveries {
+			select {
+			case e.msgs <- Message{CorrelationID: d.CorrelationId, ReplyTo: d.ReplyTo, Body: d.Body}:
+			case <-e.done:
+				return
+			}
+		}
+	}()
+	return e, nil
+}
+
+type amqpEndpoint struct {
+	ch        *amqp.Channel
+	name      string
+	msgs      chan Message
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (e *amqpEndpoint) Name() string {
+	return e.name
+}
+
+func (e *amqpEndpoint) Messages() <-chan Message {
+	return e.msgs
+}
+
+func (e *amqpEndpoint) Publish(queue string, msg Message) error {
+	return e.ch.Publish(
+		"",    // exchange
+		queue, // routing key
+		false, // mandatory
+		false, // immediate
+		amqp.Publishing{
+			ContentType:   "application/json",
+			CorrelationId: msg.CorrelationID,
+			ReplyTo:       msg.ReplyTo,
+			Body:          msg.Body,
+		},
+	)
+}
+
+func (e *amqpEndpoint) Close() error {
+	e.closeOnce.Do(func() { close(e.done) })
+	return e.ch.Close()
+}
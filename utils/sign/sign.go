@@ -0,0 +1,40 @@
+package sign
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Layout timestamp参数的格式，本地时间
+const Layout = "20060102150405"
+
+// Sign 网关默认方式的签名：去掉sign后参数按key排序拼接（不转义），加上&key=signKey，MD5大写
+func Sign(values url.Values, key string) string {
+	params := url.Values{}
+	for k, v := range values {
+		if k != "sign" {
+			params[k] = v
+		}
+	}
+	data, _ := url.QueryUnescape(params.Encode())
+	sum := md5.Sum([]byte(data + "&key=" + key))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// Timestamp t对应的timestamp参数
+func Timestamp(t time.Time) string {
+	return t.Local().Format(Layout)
+}
+
+// Expired timestamp是否不在当前时间前后maxAge内，无法解析时为过期
+func Expired(timestamp string, now time.Time, maxAge time.Duration) bool {
+	t, err := time.ParseInLocation(Layout, timestamp, time.Local)
+	if err != nil {
+		return true
+	}
+	d := now.Sub(t)
+	return d < -maxAge || d > maxAge
+}